@@ -0,0 +1,406 @@
+package unicon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// DefaultMaxAdminBody is the size limit of the PATCH requests of an
+// AdminHandler
+const DefaultMaxAdminBody = 1 << 20
+
+// AdminAction is what a caller of an AdminHandler does with a key
+type AdminAction string
+
+const (
+	// AdminView reads the value of a key
+	AdminView AdminAction = "view"
+	// AdminReveal reads the value of a sensitive key, which is redacted
+	// otherwise
+	AdminReveal AdminAction = "reveal"
+	// AdminSet overrides the value of a key
+	AdminSet AdminAction = "set"
+	// AdminDelete removes the override of a key
+	AdminDelete AdminAction = "delete"
+)
+
+// AuditEntry records a change made through an AdminHandler
+type AuditEntry struct {
+	Time    time.Time
+	Request *http.Request
+	Action  AdminAction
+	Key     string
+	// Old and New are the values of the key before and after the change
+	Old, New interface{}
+}
+
+// AdminHandler is an http.Handler to inspect the config and override it at
+// runtime:
+//
+//	GET /             lists the keys with their value and source
+//	GET /key          explains the value of key, see Unicon.Explain
+//	PATCH /           overrides the keys of a JSON object body
+//	PATCH /key        overrides key with the JSON value of the body
+//	DELETE /key       removes the overrides of key and its children
+//
+// Overrides are Set on the Unicon itself, above all its layers.  A PATCH
+// replaces the overrides of the keys it sets and of their children, so an
+// array that gets shorter leaves no stale elements.  Mount the handler with
+// http.StripPrefix when it isn't served at the root.
+type AdminHandler struct {
+	Config *Unicon
+	// Authorize, if set, reports whether r may perform action on key.
+	// Keys that can't be viewed are left out of the listing, and the values
+	// of sensitive keys are redacted unless AdminReveal is allowed.  When
+	// Authorize is nil every key can be viewed, with sensitive values
+	// redacted, and no key can be changed.
+	Authorize func(r *http.Request, action AdminAction, key string) bool
+	// Sensitive, if set, reports which keys are redacted in addition to the
+	// keys marked by SensitiveConfig layers
+	Sensitive func(key string) bool
+	// Validate, if set, checks the value of every key before a change is
+	// applied, the value is nil when an override is deleted.  A change is
+	// applied only if all of its keys are valid.  If nil, a key can only be
+	// set to a value of the type it has, and keys that have no value can't
+	// be added, except the elements of an array.
+	Validate func(key string, value interface{}) error
+	// Audit is called for every key changed, the changes are logged with
+	// the log package if nil
+	Audit func(AuditEntry)
+}
+
+// NewAdminHandler creates a new AdminHandler for uni
+func NewAdminHandler(uni *Unicon) *AdminHandler {
+	return &AdminHandler{Config: uni}
+}
+
+// adminValue is a key of the listing
+type adminValue struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+func (ah *AdminHandler) allowed(r *http.Request, action AdminAction, key string) bool {
+	if ah.Authorize == nil {
+		return action == AdminView
+	}
+	return ah.Authorize(r, action, key)
+}
+
+// sensitive reports whether key, or a parent of key, is marked by the
+// Sensitive function or by the SensitiveConfig layer that supplies it
+func (ah *AdminHandler) sensitive(key string) bool {
+	_, ok := sensitivePrefix(key, func(key string) bool {
+		return (ah.Sensitive != nil && ah.Sensitive(key)) || ah.Config.Sensitive(key)
+	})
+	return ok
+}
+
+// redacted returns value, or RedactedValue if it is sensitive and r may not
+// reveal key
+func (ah *AdminHandler) redacted(r *http.Request, key string, value interface{}, sensitive bool) interface{} {
+	if value != nil && sensitive && !ah.allowed(r, AdminReveal, key) {
+		return RedactedValue
+	}
+	return value
+}
+
+// validate checks a change, lengths holds the lengths of the arrays the
+// changes set
+func (ah *AdminHandler) validate(key string, value interface{}, lengths map[string]int) error {
+	if ah.Validate != nil {
+		return ah.Validate(key, value)
+	}
+	return ah.checkType(key, value, lengths)
+}
+
+// checkType validates the changes when there is no Validate function
+func (ah *AdminHandler) checkType(key string, value interface{}, lengths map[string]int) error {
+	if value == nil {
+		return nil
+	}
+	old := ah.Config.Get(key)
+	if old == nil {
+		if ah.inArray(key, lengths) {
+			return nil
+		}
+		return fmt.Errorf("not set")
+	}
+	switch old.(type) {
+	case time.Duration:
+		_, err := cast.ToDurationE(value)
+		return err
+	case time.Time:
+		_, err := cast.ToTimeE(value)
+		return err
+	}
+	if kindOf(old) != kindOf(value) {
+		return fmt.Errorf("must be a %s, not a %s", kindOf(old), kindOf(value))
+	}
+	return nil
+}
+
+// inArray reports whether key is inside an element of an array that is
+// set, at an index up to its length, so that an element can be appended
+// but the array can't be made to hold a huge hole.  The length is taken
+// from lengths if the changes set the array too.
+func (ah *AdminHandler) inArray(key string, lengths map[string]int) bool {
+	for _, prefix := range keyPrefixes(key) {
+		if !strings.HasSuffix(prefix, "]") {
+			continue
+		}
+		open := strings.LastIndex(prefix, "[")
+		array := prefix[:open]
+		index, err := strconv.Atoi(prefix[open+1 : len(prefix)-1])
+		if err != nil || index < 0 {
+			continue
+		}
+		length, ok := lengths[strings.ToLower(array)]
+		if !ok {
+			length, ok = ah.Config.Get(array + ".length").(int)
+		}
+		if ok && index <= length {
+			return true
+		}
+	}
+	return false
+}
+
+// kindOf names the kind of value the way JSON does
+func kindOf(value interface{}) string {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// ServeHTTP serves the admin requests
+func (ah *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.Trim(r.URL.Path, "/")
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		ah.list(w, r)
+	case r.Method == http.MethodGet:
+		ah.explain(w, r, key)
+	case r.Method == http.MethodPatch:
+		ah.patch(w, r, key)
+	case r.Method == http.MethodDelete && key != "":
+		ah.delete(w, r, key)
+	default:
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("unicon: %s not allowed", r.Method))
+	}
+}
+
+func (ah *AdminHandler) list(w http.ResponseWriter, r *http.Request) {
+	out := make(map[string]adminValue)
+	for key, value := range ah.Config.subtree() {
+		if !ah.allowed(r, AdminView, key) {
+			continue
+		}
+		out[key] = adminValue{Value: ah.redacted(r, key, value, ah.sensitive(key)), Source: ah.Config.Source(key)}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (ah *AdminHandler) explain(w http.ResponseWriter, r *http.Request, key string) {
+	if !ah.allowed(r, AdminView, key) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("unicon: viewing %s is not allowed", key))
+		return
+	}
+	exp := ah.Config.Explain(key)
+	if exp.Source == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unicon: %s is not set", key))
+		return
+	}
+	exp.Value = ah.redacted(r, key, exp.Value, ah.sensitive(key))
+	for i, lv := range exp.Layers {
+		// every layer is checked on its own, a layer below the one that
+		// supplies the value may hold a secret too
+		sensitive := lv.Sensitive
+		if ah.Sensitive != nil {
+			_, matched := sensitivePrefix(key, ah.Sensitive)
+			sensitive = sensitive || matched
+		}
+		exp.Layers[i].Value = ah.redacted(r, key, lv.Value, sensitive)
+	}
+	writeJSON(w, http.StatusOK, exp)
+}
+
+// change is the new value of a key, nil to delete its override
+type change struct {
+	key   string
+	value interface{}
+}
+
+func (ah *AdminHandler) patch(w http.ResponseWriter, r *http.Request, key string) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, DefaultMaxAdminBody+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(body) > DefaultMaxAdminBody {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("unicon: body is larger than %d bytes", DefaultMaxAdminBody))
+		return
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unicon: decoding body: %v", err))
+		return
+	}
+	if _, ok := value.(map[string]interface{}); key == "" && !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unicon: body must be an object"))
+		return
+	}
+	values := make(map[string]interface{})
+	var replaced []string
+	if key == "" {
+		for k := range value.(map[string]interface{}) {
+			replaced = append(replaced, k)
+		}
+		unmarshalMap(value.(map[string]interface{}), "", values)
+	} else {
+		replaced = append(replaced, key)
+		unmarshal(value, key, values)
+	}
+	var changes []change
+	for k, v := range values {
+		changes = append(changes, change{k, v})
+	}
+	// the overrides that are replaced without a new value are removed
+	for _, k := range replaced {
+		for _, name := range ah.overridden(k) {
+			if _, ok := values[name]; !ok {
+				changes = append(changes, change{key: name})
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].key < changes[j].key })
+	ah.apply(w, r, AdminSet, replaced, changes)
+}
+
+func (ah *AdminHandler) delete(w http.ResponseWriter, r *http.Request, key string) {
+	var changes []change
+	for _, name := range ah.overridden(key) {
+		changes = append(changes, change{key: name})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].key < changes[j].key })
+	if len(changes) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unicon: %s is not overridden", key))
+		return
+	}
+	ah.apply(w, r, AdminDelete, []string{key}, changes)
+}
+
+// overridden returns the overridden keys among key and its children
+func (ah *AdminHandler) overridden(key string) []string {
+	root, full := ah.Config.resolve(key)
+	var keys []string
+	for name := range root.overrides.All() {
+		if isKeyOrChild(name, full) {
+			keys = append(keys, key+name[len(full):])
+		}
+	}
+	return keys
+}
+
+// apply authorizes, validates and applies all the changes, or none.  The
+// overrides of the replaced keys and of their children are removed before
+// the changes are applied.
+func (ah *AdminHandler) apply(w http.ResponseWriter, r *http.Request, action AdminAction, replaced []string, changes []change) {
+	lengths := make(map[string]int)
+	for _, c := range changes {
+		if length, ok := c.value.(int); ok && strings.HasSuffix(c.key, ".length") {
+			lengths[strings.ToLower(strings.TrimSuffix(c.key, ".length"))] = length
+		}
+	}
+	for _, c := range changes {
+		if !ah.allowed(r, action, c.key) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("unicon: %s of %s is not allowed", action, c.key))
+			return
+		}
+		if err := ah.validate(c.key, c.value, lengths); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, fmt.Errorf("unicon: invalid %s: %v", c.key, err))
+			return
+		}
+	}
+
+	root, _ := ah.Config.resolve("")
+	entries := make([]AuditEntry, 0, len(changes))
+	// the changes are made under the lock of Set, none of its changes are
+	// lost and readers see all the changes or none
+	root.updateOverrides(func(overrides map[string]interface{}) {
+		for _, c := range changes {
+			entries = append(entries, AuditEntry{
+				Time:    time.Now(),
+				Request: r,
+				Action:  action,
+				Key:     c.key,
+				Old:     ah.Config.Get(c.key),
+				New:     c.value,
+			})
+		}
+		for _, key := range replaced {
+			// the key in any casing and all its children
+			_, full := ah.Config.resolve(key)
+			for name := range overrides {
+				if isKeyOrChild(name, full) {
+					delete(overrides, name)
+				}
+			}
+		}
+		for _, c := range changes {
+			if c.value != nil {
+				_, full := ah.Config.resolve(c.key)
+				overrides[full] = c.value
+			}
+		}
+	})
+
+	for i := range entries {
+		entries[i].New = ah.Config.Get(entries[i].Key)
+		ah.audit(entries[i])
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ah *AdminHandler) audit(entry AuditEntry) {
+	if ah.Audit != nil {
+		ah.Audit(entry)
+		return
+	}
+	before, after := entry.Old, entry.New
+	if ah.sensitive(entry.Key) {
+		before, after = RedactedValue, RedactedValue
+	}
+	log.Printf("unicon: %s %s %s: %v -> %v", entry.Request.RemoteAddr, entry.Action, entry.Key, before, after)
+}
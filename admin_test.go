@@ -0,0 +1,285 @@
+package unicon_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+// settingConfig calls set in the background on every All and gives it the
+// time to run
+type settingConfig struct {
+	*MemoryConfig
+	set   func(i int)
+	mu    sync.Mutex
+	count int
+}
+
+func (sc *settingConfig) All() map[string]interface{} {
+	all := sc.MemoryConfig.All()
+	sc.mu.Lock()
+	set, i := sc.set, sc.count
+	if set != nil {
+		sc.count++
+	}
+	sc.mu.Unlock()
+	if set != nil {
+		go set(i)
+		time.Sleep(20 * time.Millisecond)
+	}
+	return all
+}
+
+func (sc *settingConfig) Count() int {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.count
+}
+
+var _ = Describe("AdminHandler", func() {
+	var (
+		uni     *Unicon
+		admin   *AdminHandler
+		entries []AuditEntry
+	)
+
+	BeforeEach(func() {
+		uni = NewConfig(nil)
+		uni.SetDefault("port", 8080)
+		uni.SetDefault("db.host", "localhost")
+		uni.Use("env", NewEnvConfigFrom(EnvList{"DB_HOST=db.example.com", "DB_PASSWORD=hunter2"}, "", "db"))
+		entries = nil
+		admin = NewAdminHandler(uni)
+		admin.Sensitive = MatchKeys("*password")
+		admin.Authorize = func(r *http.Request, action AdminAction, key string) bool {
+			if r.Header.Get("Authorization") == "admin" {
+				return true
+			}
+			return action == AdminView && !strings.HasSuffix(strings.ToLower(key), "password")
+		}
+		admin.Audit = func(entry AuditEntry) {
+			entries = append(entries, entry)
+		}
+	})
+
+	request := func(h http.Handler, method, path, body string, admin bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if admin {
+			req.Header.Set("Authorization", "admin")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	decodeBody := func(rec *httptest.ResponseRecorder) map[string]interface{} {
+		var out map[string]interface{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &out)).To(Succeed())
+		return out
+	}
+
+	It("Should list the keys the caller may view with their source", func() {
+		rec := request(admin, http.MethodGet, "/", "", false)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		body := decodeBody(rec)
+		Expect(body).To(HaveKeyWithValue("DB.HOST", map[string]interface{}{"value": "db.example.com", "source": "env"}))
+		Expect(body).To(HaveKeyWithValue("port", map[string]interface{}{"value": float64(8080), "source": "default"}))
+		Expect(body).ToNot(HaveKey("DB.PASSWORD"))
+
+		body = decodeBody(request(admin, http.MethodGet, "/", "", true))
+		Expect(body).To(HaveKeyWithValue("DB.PASSWORD", HaveKeyWithValue("value", "hunter2")))
+	})
+
+	It("Should explain a single key", func() {
+		rec := request(admin, http.MethodGet, "/db.host", "", false)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(decodeBody(rec)).To(Equal(map[string]interface{}{
+			"key":    "db.host",
+			"value":  "db.example.com",
+			"source": "env",
+			"layers": []interface{}{
+				map[string]interface{}{"layer": "env", "value": "db.example.com"},
+				map[string]interface{}{"layer": "default", "value": "localhost"},
+			},
+		}))
+		Expect(request(admin, http.MethodGet, "/db.password", "", false).Code).To(Equal(http.StatusForbidden))
+		Expect(request(admin, http.MethodGet, "/missing", "", false).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("Should override keys and audit the changes", func() {
+		rec := request(admin, http.MethodPatch, "/", `{"db":{"host":"override.example.com"},"port":9090}`, true)
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(uni.Get("db.host")).To(Equal("override.example.com"))
+		Expect(uni.Source("db.host")).To(Equal("override"))
+		Expect(uni.GetInt("port")).To(Equal(9090))
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Key).To(Equal("db.host"))
+		Expect(entries[0].Action).To(Equal(AdminSet))
+		Expect(entries[0].Old).To(Equal("db.example.com"))
+		Expect(entries[0].New).To(Equal("override.example.com"))
+
+		rec = request(admin, http.MethodPatch, "/port", `7070`, true)
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(uni.GetInt("port")).To(Equal(7070))
+	})
+
+	It("Should replace the overrides of arrays and objects", func() {
+		uni.Set("db.replicas", []interface{}{"a", "b", "c"})
+		uni.Set("db.options.tls", true)
+		admin.Validate = func(string, interface{}) error { return nil }
+		rec := request(admin, http.MethodPatch, "/db", `{"replicas":["x"],"options":"none"}`, true)
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(uni.Get("db.replicas[0]")).To(Equal("x"))
+		Expect(uni.Get("db.replicas[1]")).To(BeNil())
+		Expect(uni.Get("db.replicas.length")).To(Equal(1))
+		Expect(uni.Get("db.options.tls")).To(BeNil())
+		Expect(uni.Get("db.options")).To(Equal("none"))
+	})
+
+	It("Should not lose the changes made with Set meanwhile", func() {
+		// every read of the overrides sets another key meanwhile
+		overrides := &settingConfig{MemoryConfig: NewMemoryConfig()}
+		uni = NewConfig(overrides)
+		uni.Set("port", 8080)
+		overrides.set = func(i int) { uni.Set(fmt.Sprintf("set.k%d", i), i) }
+		admin = NewAdminHandler(uni)
+		admin.Authorize = func(*http.Request, AdminAction, string) bool { return true }
+		admin.Audit = func(AuditEntry) {}
+		Expect(request(admin, http.MethodPatch, "/port", `9090`, true).Code).To(Equal(http.StatusNoContent))
+		sets := overrides.Count()
+		Expect(sets).To(BeNumerically(">", 0))
+		for i := 0; i < sets; i++ {
+			Eventually(func() interface{} { return uni.Get(fmt.Sprintf("set.k%d", i)) }).Should(Equal(i))
+		}
+		Expect(uni.GetInt("port")).To(Equal(9090))
+	})
+
+	It("Should remove overrides", func() {
+		uni.Set("db.host", "override.example.com")
+		rec := request(admin, http.MethodDelete, "/db", "", true)
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(uni.Get("db.host")).To(Equal("db.example.com"))
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Action).To(Equal(AdminDelete))
+		Expect(entries[0].New).To(Equal("db.example.com"))
+		Expect(request(admin, http.MethodDelete, "/db", "", true).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("Should refuse unauthorised changes", func() {
+		rec := request(admin, http.MethodPatch, "/", `{"port":9090}`, false)
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(uni.GetInt("port")).To(Equal(8080))
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("Should validate all the changes before applying any", func() {
+		admin.Validate = func(key string, value interface{}) error {
+			if key == "port" && value.(float64) < 1024 {
+				return errors.New("port is privileged")
+			}
+			return nil
+		}
+		rec := request(admin, http.MethodPatch, "/", `{"db":{"host":"x"},"port":80}`, true)
+		Expect(rec.Code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(decodeBody(rec)["error"]).To(ContainSubstring("port is privileged"))
+		Expect(uni.Get("db.host")).To(Equal("db.example.com"))
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("Should only change keys to values of their type without Validate", func() {
+		uni.Set("db.replicas", []interface{}{"a"})
+		uni.SetDefault("timeout", 5*time.Second)
+		rec := request(admin, http.MethodPatch, "/port", `"80"`, true)
+		Expect(rec.Code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(decodeBody(rec)["error"]).To(ContainSubstring("must be a number, not a string"))
+		rec = request(admin, http.MethodPatch, "/debug", `true`, true)
+		Expect(rec.Code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(decodeBody(rec)["error"]).To(ContainSubstring("not set"))
+		Expect(request(admin, http.MethodPatch, "/timeout", `"nope"`, true).Code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(uni.Get("debug")).To(BeNil())
+
+		Expect(request(admin, http.MethodPatch, "/timeout", `"10s"`, true).Code).To(Equal(http.StatusNoContent))
+		Expect(uni.GetDuration("timeout")).To(Equal(10 * time.Second))
+		Expect(request(admin, http.MethodPatch, "/db.replicas", `["a","b"]`, true).Code).To(Equal(http.StatusNoContent))
+		Expect(uni.Get("db.replicas[1]")).To(Equal("b"))
+		Expect(request(admin, http.MethodPatch, "/db.replicas[2]", `"c"`, true).Code).To(Equal(http.StatusNoContent))
+		Expect(uni.Get("db.replicas[2]")).To(Equal("c"))
+		Expect(request(admin, http.MethodPatch, "/db.replicas[99999999999]", `"x"`, true).Code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(request(admin, http.MethodPatch, "/db.replicas[4].name", `"x"`, true).Code).To(Equal(http.StatusUnprocessableEntity))
+	})
+
+	It("Should redact sensitive values unless revealing them is allowed", func() {
+		admin.Authorize = func(r *http.Request, action AdminAction, key string) bool {
+			return action == AdminView
+		}
+		body := decodeBody(request(admin, http.MethodGet, "/", "", true))
+		Expect(body).To(HaveKeyWithValue("DB.PASSWORD", HaveKeyWithValue("value", RedactedValue)))
+		Expect(decodeBody(request(admin, http.MethodGet, "/db.password", "", true))["value"]).To(Equal(RedactedValue))
+	})
+
+	It("Should redact the secrets of every layer when explaining a key", func() {
+		admin.Authorize = func(r *http.Request, action AdminAction, key string) bool {
+			return action == AdminView
+		}
+		secrets := secretConfig{NewMemoryConfig()}
+		secrets.Set("db.host", "secret.example.com")
+		uni.Use("secrets", secrets)
+		Expect(decodeBody(request(admin, http.MethodGet, "/db.host", "", false))).To(Equal(map[string]interface{}{
+			"key":    "db.host",
+			"value":  "db.example.com",
+			"source": "env",
+			"layers": []interface{}{
+				map[string]interface{}{"layer": "env", "value": "db.example.com"},
+				map[string]interface{}{"layer": "secrets", "value": RedactedValue, "sensitive": true},
+				map[string]interface{}{"layer": "default", "value": "localhost"},
+			},
+		}))
+	})
+
+	It("Should redact the children of sensitive keys", func() {
+		admin.Authorize = nil
+		admin.Sensitive = MatchKeys("tls")
+		uni.Set("tls.key", "pem")
+		uni.SetDefault("tls.key", "default pem")
+		body := decodeBody(request(admin, http.MethodGet, "/", "", false))
+		Expect(body).To(HaveKeyWithValue("tls.key", HaveKeyWithValue("value", RedactedValue)))
+		exp := decodeBody(request(admin, http.MethodGet, "/tls.key", "", false))
+		Expect(exp["value"]).To(Equal(RedactedValue))
+		Expect(exp["layers"]).To(Equal([]interface{}{
+			map[string]interface{}{"layer": "override", "value": RedactedValue},
+			map[string]interface{}{"layer": "default", "value": RedactedValue},
+		}))
+	})
+
+	It("Should reject bodies that aren't json", func() {
+		Expect(request(admin, http.MethodPatch, "/", `nope`, true).Code).To(Equal(http.StatusBadRequest))
+		Expect(request(admin, http.MethodPatch, "/", `[1]`, true).Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("Should only allow viewing without Authorize", func() {
+		admin.Authorize = nil
+		body := decodeBody(request(admin, http.MethodGet, "/", "", false))
+		Expect(body).To(HaveKeyWithValue("DB.PASSWORD", HaveKeyWithValue("value", RedactedValue)))
+		Expect(request(admin, http.MethodPatch, "/port", `1`, true).Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("Should manage the keys of a Sub", func() {
+		sub := NewAdminHandler(uni.Sub("db"))
+		sub.Authorize = admin.Authorize
+		sub.Audit = admin.Audit
+		body := decodeBody(request(sub, http.MethodGet, "/", "", false))
+		Expect(body).To(HaveKey("HOST"))
+		Expect(body).ToNot(HaveKey("port"))
+		Expect(request(sub, http.MethodPatch, "/host", `"sub.example.com"`, true).Code).To(Equal(http.StatusNoContent))
+		Expect(uni.Get("db.host")).To(Equal("sub.example.com"))
+	})
+})
@@ -1,20 +1,39 @@
 package unicon
 
 import (
-	"flag"
+	"fmt"
 	"os"
 	"strings"
 )
 
-// ArgvConfig is the Argv configurable.
+// ArgvConfig is the Argv configurable.  It parses free form command line
+// arguments without any flag definitions:
+//
+//	--a.b.c=value sets a.b.c to "value"
+//	--a.b.c value does too, unless a.b.c is one of the BoolFlags
+//	--flag sets flag to true when no value follows it
+//	--no-flag sets flag to false
+//	repeated flags are collected into an array
+//	-- ends the flags, everything after it is positional
 type ArgvConfig struct {
 	Configurable
-	Prefix     string
+	Prefix string
+	// Decoder, if set, decodes the values into typed values
+	Decoder *ValueDecoder
+	// Argv are the arguments to parse without the program name, os.Args[1:]
+	// if nil
+	Argv []string
+	// BoolFlags are the names of the flags that never take the argument
+	// following them as their value, they only get a value with "=" and
+	// are true otherwise.  Listing verbose keeps input.txt positional in
+	// --verbose input.txt.
+	BoolFlags  []string
 	namespaces []string
+	positional []string
 }
 
-// NewArgvConfig creates a new ArgvConfig and returns it as a ReadableConfig
-func NewArgvConfig(prefix string, namespaces ...string) ReadableConfig {
+// NewArgvConfig creates a new ArgvConfig and returns it
+func NewArgvConfig(prefix string, namespaces ...string) *ArgvConfig {
 	cfg := &ArgvConfig{
 		Configurable: NewMemoryConfig(),
 		Prefix:       prefix,
@@ -23,29 +42,119 @@ func NewArgvConfig(prefix string, namespaces ...string) ReadableConfig {
 	return cfg
 }
 
+// Positional returns the arguments that aren't flags or flag values, as of
+// the last Load
+func (ac *ArgvConfig) Positional() []string {
+	return ac.positional
+}
+
+func (ac *ArgvConfig) args() []string {
+	if ac.Argv != nil {
+		return ac.Argv
+	}
+	if len(os.Args) > 1 {
+		return os.Args[1:]
+	}
+	return nil
+}
+
+// parseArgv splits args into the values of each flag, in the order the
+// flags were first seen, and the positional arguments.  The flags that
+// aren't in boolFlags take the following argument as their value.
+func parseArgv(args []string, boolFlags []string) (names []string, values map[string][]interface{}, positional []string) {
+	isBool := make(map[string]bool, len(boolFlags))
+	for _, name := range boolFlags {
+		isBool[name] = true
+	}
+	values = make(map[string][]interface{})
+	add := func(name string, value interface{}) {
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = append(values[name], value)
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			positional = append(positional, arg)
+			continue
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if name == "" || name[0] == '=' {
+			// --=x has no name
+			positional = append(positional, arg)
+			continue
+		}
+		if eq := strings.Index(name, "="); eq >= 0 {
+			add(name[:eq], name[eq+1:])
+			continue
+		}
+		if strings.HasPrefix(name, "no-") && len(name) > 3 {
+			add(name[3:], false)
+			continue
+		}
+		if !isBool[name] && i+1 < len(args) && isArgvValue(args[i+1]) {
+			add(name, args[i+1])
+			i++
+			continue
+		}
+		add(name, true)
+	}
+	return
+}
+
+// isArgvValue reports whether arg following a flag is its value, that is
+// arg isn't a flag itself, negative numbers are values
+func isArgvValue(arg string) bool {
+	if !strings.HasPrefix(arg, "-") || arg == "-" {
+		return true
+	}
+	return len(arg) > 1 && (arg[1] >= '0' && arg[1] <= '9' || arg[1] == '.')
+}
+
+func (ac *ArgvConfig) decode(name string, value interface{}) (interface{}, error) {
+	str, ok := value.(string)
+	if !ok || ac.Decoder == nil {
+		return value, nil
+	}
+	decoded, err := ac.Decoder.Decode(name, str)
+	if err != nil {
+		return nil, fmt.Errorf("unicon: decoding %s: %v", name, err)
+	}
+	return decoded, nil
+}
+
 // Load loads all the variables from argv to the underlaying Configurable.
 // If a Prefix is provided for ArgvConfig then keys are imported with the
 // Prefix removed so --test.asd=1 with Prefix 'test.' imports "asd" with
 // value of 1
 func (ac *ArgvConfig) Load() (err error) {
-	flagset := flag.NewFlagSet("arguments", flag.ContinueOnError)
-	flagset.Parse(os.Args)
+	names, parsed, positional := parseArgv(ac.args(), ac.BoolFlags)
 
-	flagset.VisitAll(func(f *flag.Flag) {
-		name := f.Name
-		if ac.Prefix != "" && strings.HasPrefix(f.Name, ac.Prefix) {
-			name = strings.Replace(name, ac.Prefix, "", 1)
-		}
+	values := make(map[string]interface{})
+	for _, flagName := range names {
+		name := flagKey(flagName, ac.Prefix, ac.namespaces)
 
-		var value interface{}
-		if getter, ok := f.Value.(flag.Getter); ok {
-			value = getter.Get().(string)
+		var items []interface{}
+		for _, value := range parsed[flagName] {
+			decoded, err := ac.decode(name, value)
+			if err != nil {
+				return err
+			}
+			items = append(items, decoded)
+		}
+		if len(items) == 1 {
+			unmarshal(items[0], name, values)
 		} else {
-			value = f.Value.String()
+			unmarshal(items, name, values)
 		}
+	}
 
-		name = namespaceKey(name, ac.namespaces)
-		ac.Set(name, value)
-	})
+	ac.Reset(values)
+	ac.positional = positional
 	return nil
 }
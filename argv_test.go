@@ -22,4 +22,67 @@ var _ = Describe("ArgvConfig", func() {
 		cfg2.Load()
 		Expect(len(cfg2.All()) >= len(cfg.All())).To(BeTrue())
 	})
+	It("Should parse free form flags", func() {
+		argv := NewArgvConfig("")
+		argv.Argv = []string{
+			"--myapp.db.host=x", "--myapp.db.port", "5432",
+			"-v", "--no-color", "--offset", "-5",
+			"--tag", "a", "--tag=b", "--debug",
+			"--", "input.txt", "--not-a-flag",
+		}
+		Expect(argv.Load()).To(Succeed())
+		Expect(argv.Get("myapp.db.host")).To(Equal("x"))
+		Expect(argv.GetInt("myapp.db.port")).To(Equal(5432))
+		Expect(argv.Get("v")).To(Equal(true))
+		Expect(argv.Get("debug")).To(Equal(true))
+		Expect(argv.Get("color")).To(Equal(false))
+		Expect(argv.GetInt("offset")).To(Equal(-5))
+		Expect(argv.Get("tag[0]")).To(Equal("a"))
+		Expect(argv.Get("tag[1]")).To(Equal("b"))
+		Expect(argv.Get("tag.length")).To(Equal(2))
+		Expect(argv.Get("not-a-flag")).To(BeNil())
+		Expect(argv.Positional()).To(Equal([]string{"input.txt", "--not-a-flag"}))
+	})
+	It("Should not take the next argument as the value of bool flags", func() {
+		argv := NewArgvConfig("")
+		argv.Argv = []string{"--verbose", "input.txt", "--level", "3", "--dry-run=false", "--no-color", "b.txt"}
+		argv.BoolFlags = []string{"verbose", "dry-run"}
+		Expect(argv.Load()).To(Succeed())
+		Expect(argv.Get("verbose")).To(Equal(true))
+		Expect(argv.Get("level")).To(Equal("3"))
+		Expect(argv.Get("dry-run")).To(Equal("false"))
+		Expect(argv.Get("color")).To(Equal(false))
+		Expect(argv.Positional()).To(Equal([]string{"input.txt", "b.txt"}))
+	})
+	It("Should treat flags without a name as positional", func() {
+		argv := NewArgvConfig("")
+		argv.Argv = []string{"--=x", "-=y", "--a=1"}
+		Expect(argv.Load()).To(Succeed())
+		Expect(argv.All()).To(Equal(map[string]interface{}{"a": "1"}))
+		Expect(argv.Get("")).To(BeNil())
+		Expect(argv.Positional()).To(Equal([]string{"--=x", "-=y"}))
+	})
+	It("Should remove the prefix and namespace keys", func() {
+		argv := NewArgvConfig("myapp-", "db")
+		argv.Argv = []string{"--myapp-db-host=x"}
+		Expect(argv.Load()).To(Succeed())
+		Expect(argv.Get("db.host")).To(Equal("x"))
+	})
+	It("Should decode values", func() {
+		argv := NewArgvConfig("")
+		argv.Decoder = &ValueDecoder{Separator: ","}
+		argv.Argv = []string{"--ports=80,443", `--servers=["a"]`}
+		Expect(argv.Load()).To(Succeed())
+		Expect(argv.GetInt("ports[1]")).To(Equal(443))
+		Expect(argv.Get("servers[0]")).To(Equal("a"))
+	})
+	It("Should drop flags that are gone on reload", func() {
+		argv := NewArgvConfig("")
+		argv.Argv = []string{"--a=1"}
+		Expect(argv.Load()).To(Succeed())
+		argv.Argv = []string{"--b=2"}
+		Expect(argv.Load()).To(Succeed())
+		Expect(argv.Get("a")).To(BeNil())
+		Expect(argv.Get("b")).To(Equal("2"))
+	})
 })
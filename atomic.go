@@ -0,0 +1,126 @@
+package unicon
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic replaces the file at path with data so that readers see
+// either the old or the new contents, never a partial write.  data is
+// written to a temporary file in the same directory, synced and renamed
+// over path, keeping the mode and owner of the existing file.  When path
+// is a symlink the file it points to is replaced and the link is kept.
+// Writers in other processes are serialized with an advisory lock on the
+// directory of the file, so no lock file is needed.  If backups is
+// positive the replaced file is kept as path + ".1", older backups are
+// rotated up to path + "." + backups.
+func writeFileAtomic(path string, data []byte, backups int) (err error) {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	unlock, err := lockDir(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	mode := os.FileMode(0600)
+	info, statErr := os.Stat(path)
+	if statErr == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	if statErr == nil {
+		chown(tmp.Name(), info)
+		if backups > 0 {
+			if err = rotateBackups(path, backups); err != nil {
+				return err
+			}
+		}
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// rotateBackups shifts path.1 .. path.(n-1) up by one and keeps a copy of
+// path as path.1.  path itself stays in place until it is replaced.
+func rotateBackups(path string, n int) error {
+	backup := func(i int) string {
+		return fmt.Sprintf("%s.%d", path, i)
+	}
+	if err := os.Remove(backup(n)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := n - 1; i >= 1; i-- {
+		if err := os.Rename(backup(i), backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Link(path, backup(1)); err == nil {
+		return nil
+	}
+	return copyFile(path, backup(1))
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir flushes the rename of a file in dir to disk, it is best effort
+// as not every platform can sync a directory
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
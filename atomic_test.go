@@ -0,0 +1,123 @@
+package unicon_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+var _ = Describe("Atomic Save", func() {
+	var (
+		dir  string
+		path string
+	)
+
+	read := func(path string) string {
+		data, err := ioutil.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		return string(data)
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "unicon-save")
+		Expect(err).ToNot(HaveOccurred())
+		path = filepath.Join(dir, "config.json")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("Should create new files with mode 0600", func() {
+		cfg := NewJSONConfig(path)
+		cfg.Set("a", 1)
+		Expect(cfg.Save()).To(Succeed())
+		info, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("Should keep the mode of an existing file", func() {
+		Expect(ioutil.WriteFile(path, []byte(`{}`), 0600)).To(Succeed())
+		Expect(os.Chmod(path, 0640)).To(Succeed())
+		cfg := NewJSONConfig(path)
+		cfg.Set("a", 1)
+		Expect(cfg.Save()).To(Succeed())
+		info, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+		Expect(read(path)).To(Equal(`{"a":1}`))
+	})
+
+	It("Should not leave temporary files behind", func() {
+		cfg := NewJSONConfig(path)
+		cfg.Set("a", 1)
+		Expect(cfg.Save()).To(Succeed())
+		files, err := filepath.Glob(filepath.Join(dir, ".config.json.tmp*"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(BeEmpty())
+	})
+
+	It("Should not leave a lock file beside the config", func() {
+		cfg := NewJSONConfig(path)
+		cfg.Set("a", 1)
+		Expect(cfg.Save()).To(Succeed())
+		files, err := ioutil.ReadDir(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+	})
+
+	It("Should replace the target of a symlink and keep the link", func() {
+		target := filepath.Join(dir, "target.json")
+		Expect(ioutil.WriteFile(target, []byte(`{}`), 0600)).To(Succeed())
+		Expect(os.Symlink("target.json", path)).To(Succeed())
+		cfg := &JSONConfig{Configurable: NewMemoryConfig(), Path: path, Backups: 1}
+		cfg.Set("a", 1)
+		Expect(cfg.Save()).To(Succeed())
+		info, err := os.Lstat(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode() & os.ModeSymlink).ToNot(BeZero())
+		Expect(read(target)).To(Equal(`{"a":1}`))
+		Expect(read(target + ".1")).To(Equal(`{}`))
+	})
+
+	It("Should rotate backups", func() {
+		cfg := &JSONConfig{Configurable: NewMemoryConfig(), Path: path, Backups: 2}
+		for i := 1; i <= 4; i++ {
+			cfg.Set("a", i)
+			Expect(cfg.Save()).To(Succeed())
+		}
+		Expect(read(path)).To(Equal(`{"a":4}`))
+		Expect(read(path + ".1")).To(Equal(`{"a":3}`))
+		Expect(read(path + ".2")).To(Equal(`{"a":2}`))
+		Expect(path + ".3").ToNot(BeAnExistingFile())
+	})
+
+	It("Should serialize concurrent writers", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				cfg := &FileConfig{Configurable: NewMemoryConfig(), Path: path, Backups: 1}
+				cfg.Set("writer", fmt.Sprint(i))
+				Expect(cfg.Save()).To(Succeed())
+			}(i)
+		}
+		wg.Wait()
+		for _, file := range []string{path, path + ".1"} {
+			out := make(map[string]interface{})
+			Expect(json.Unmarshal([]byte(read(file)), &out)).To(Succeed())
+			Expect(out).To(HaveKey("writer"))
+		}
+	})
+})
@@ -0,0 +1,122 @@
+package unicon
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Codec decodes the contents of a configuration file into a map and encodes
+// a map back into the file format.  Decode may return nested maps and
+// arrays, they are flattened into dotted keys by the file backed configs.
+type Codec interface {
+	Decode([]byte) (map[string]interface{}, error)
+	Encode(map[string]interface{}) ([]byte, error)
+}
+
+// JSONCodec is the Codec for json documents
+type JSONCodec struct {
+	// Indent, if set, is used to indent each level of the encoded document
+	Indent string
+}
+
+// Decode unmarshals a json object
+func (JSONCodec) Decode(data []byte) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Encode marshals the map as a json object, object keys are sorted
+func (c JSONCodec) Encode(data map[string]interface{}) ([]byte, error) {
+	if c.Indent != "" {
+		return json.MarshalIndent(data, "", c.Indent)
+	}
+	return json.Marshal(data)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		"json": JSONCodec{},
+	}
+)
+
+func codecName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "."))
+}
+
+// RegisterCodec registers codec for files with the extension ext, ".yaml"
+// and "yaml" are equivalent.  A media type such as "application/toml" can
+// also be given to match the Content-Type of URLConfig responses.
+// Registering an already registered name replaces the codec.
+func RegisterCodec(ext string, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codecName(ext)] = codec
+}
+
+// LookupCodec returns the codec registered for the extension or media type
+func LookupCodec(ext string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[codecName(ext)]
+	return codec, ok
+}
+
+// CodecForPath returns the codec registered for the extension of path
+func CodecForPath(path string) (Codec, error) {
+	ext := filepath.Ext(path)
+	if codec, ok := LookupCodec(ext); ok && ext != "" {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("unicon: no codec registered for %q", path)
+}
+
+// codecForContentType picks a codec for a Content-Type header.  The full
+// media type is tried first, then a structured syntax suffix
+// (application/vnd.foo+json), then the subtype (text/yaml) and finally the
+// extensions known to the mime package for the media type.
+func codecForContentType(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	if codec, ok := LookupCodec(mediaType); ok {
+		return codec, true
+	}
+	subtype := mediaType[strings.Index(mediaType, "/")+1:]
+	if i := strings.LastIndex(subtype, "+"); i >= 0 {
+		if codec, ok := LookupCodec(subtype[i+1:]); ok {
+			return codec, true
+		}
+	}
+	if codec, ok := LookupCodec(strings.TrimPrefix(subtype, "x-")); ok {
+		return codec, true
+	}
+	exts, _ := mime.ExtensionsByType(mediaType)
+	for _, ext := range exts {
+		if codec, ok := LookupCodec(ext); ok {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+// decode decodes data with codec and flattens the result into dotted keys
+func decode(codec Codec, data []byte) (map[string]interface{}, error) {
+	out, err := codec.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(map[string]interface{})
+	unmarshalMap(out, "", output)
+
+	return output, nil
+}
@@ -0,0 +1,226 @@
+package unicon
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultConsulAddress is the address of the Consul agent used by
+// ConsulConfig when Address is not set
+const DefaultConsulAddress = "http://127.0.0.1:8500"
+
+// consulPair is an entry of the response of the Consul KV endpoint
+type consulPair struct {
+	Key   string
+	Value *string
+}
+
+// ConsulConfig is a configurable backed by the keys below a prefix of the
+// Consul KV store, read through the HTTP API.  The "/" of key paths become
+// dots, with Prefix "app/" the key app/db/host is imported as "db.host".
+// Values are decoded by Decoder, json objects and arrays are flattened.
+type ConsulConfig struct {
+	Configurable
+	// Address of the Consul agent, DefaultConsulAddress if empty
+	Address string
+	Prefix  string
+	// Token, if set, is the ACL token sent with the requests
+	Token string
+	// Datacenter, if set, is the datacenter to read from
+	Datacenter string
+	// Client sends the requests, a client with DefaultURLTimeout if nil
+	Client *http.Client
+	// Decoder decodes the values into typed values
+	Decoder *ValueDecoder
+
+	mu      sync.Mutex
+	index   uint64
+	sources map[string]string
+}
+
+// Ensure ConsulConfig implements SourcedConfig
+var _ SourcedConfig = (*ConsulConfig)(nil)
+
+// NewConsulConfig returns a new ReadableConfig backed by the keys below
+// prefix in the Consul agent at address
+func NewConsulConfig(address, prefix string) *ConsulConfig {
+	return &ConsulConfig{
+		Configurable: NewMemoryConfig(),
+		Address:      address,
+		Prefix:       prefix,
+		Decoder:      &ValueDecoder{},
+	}
+}
+
+func (cc *ConsulConfig) client() *http.Client {
+	if cc.Client != nil {
+		return cc.Client
+	}
+	return defaultURLClient
+}
+
+// Index returns the Consul index of the loaded keys, used by blocking
+// queries to wait for a change
+func (cc *ConsulConfig) Index() uint64 {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.index
+}
+
+// polling reports whether LongPoll can wait for a change
+func (cc *ConsulConfig) polling() bool {
+	return cc.Index() > 0
+}
+
+// version returns the index of the loaded keys
+func (cc *ConsulConfig) version() string {
+	return strconv.FormatUint(cc.Index(), 10)
+}
+
+func (cc *ConsulConfig) request(ctx context.Context, index uint64, wait time.Duration) (*http.Request, error) {
+	address := cc.Address
+	if address == "" {
+		address = DefaultConsulAddress
+	}
+	query := url.Values{"recurse": {"true"}}
+	if cc.Datacenter != "" {
+		query.Set("dc", cc.Datacenter)
+	}
+	if index > 0 && wait > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%ds", int((wait+time.Second-1)/time.Second)))
+	}
+	path := "/v1/kv/" + strings.TrimPrefix(cc.Prefix, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(address, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if cc.Token != "" {
+		req.Header.Set("X-Consul-Token", cc.Token)
+	}
+	return req, nil
+}
+
+// key maps the path of a Consul key to its key, "" for the keys that
+// aren't below Prefix, such as application/ for the Prefix app
+func (cc *ConsulConfig) key(path string) string {
+	if prefix := strings.Trim(cc.Prefix, "/"); prefix != "" {
+		if !strings.HasPrefix(path, prefix+"/") {
+			return ""
+		}
+		path = path[len(prefix)+1:]
+	}
+	return strings.Replace(strings.Trim(path, "/"), "/", ".", -1)
+}
+
+// Load reads the keys from Consul
+func (cc *ConsulConfig) Load() error {
+	return cc.LoadContext(context.Background())
+}
+
+// LoadContext reads the keys from Consul, the request is abandoned when
+// ctx is done
+func (cc *ConsulConfig) LoadContext(ctx context.Context) error {
+	return cc.load(ctx, 0)
+}
+
+// LongPoll reads the keys with a blocking query, Consul holds the request
+// for up to wait until a key below Prefix changes
+func (cc *ConsulConfig) LongPoll(ctx context.Context, wait time.Duration) error {
+	return cc.load(ctx, wait)
+}
+
+func (cc *ConsulConfig) load(ctx context.Context, wait time.Duration) error {
+	index := cc.Index()
+	req, err := cc.request(ctx, index, wait)
+	if err != nil {
+		return err
+	}
+	client := cc.client()
+	if wait > 0 && client.Timeout > 0 {
+		// leave Consul the time to hold the request, plus the jitter it adds
+		extended := *client
+		extended.Timeout += wait + wait/16
+		client = &extended
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// a missing prefix is answered with 404, there are no keys
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+		return &StatusError{URL: req.URL.Redacted(), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	latest, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("unicon: consul response without a valid X-Consul-Index: %v", err)
+	}
+	if latest == index && wait > 0 {
+		// the blocking query timed out without a change
+		return nil
+	}
+
+	var pairs []consulPair
+	if resp.StatusCode == http.StatusOK {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, DefaultMaxResponseSize+1))
+		if err != nil {
+			return err
+		}
+		if len(body) > DefaultMaxResponseSize {
+			return fmt.Errorf("unicon: consul response is larger than %d bytes", DefaultMaxResponseSize)
+		}
+		if err := json.Unmarshal(body, &pairs); err != nil {
+			return fmt.Errorf("unicon: decoding consul response: %v", err)
+		}
+	}
+	values := make(map[string]interface{})
+	sources := make(map[string]string)
+	for _, pair := range pairs {
+		key := cc.key(pair.Key)
+		if key == "" || pair.Value == nil {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(*pair.Value)
+		if err != nil {
+			return fmt.Errorf("unicon: decoding consul key %s: %v", pair.Key, err)
+		}
+		decoded := make(map[string]interface{})
+		if err := decodeValue(cc.Decoder, key, string(value), decoded); err != nil {
+			return err
+		}
+		for name, value := range decoded {
+			values[name] = value
+			sources[strings.ToLower(name)] = pair.Key
+		}
+	}
+	cc.Reset(values)
+
+	cc.mu.Lock()
+	// the index must only grow, start over if Consul resets it
+	if latest < index {
+		latest = 0
+	}
+	cc.index = latest
+	cc.sources = sources
+	cc.mu.Unlock()
+	return nil
+}
+
+// Source returns the path of the Consul key that supplied key
+func (cc *ConsulConfig) Source(key string) string {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.sources[strings.ToLower(key)]
+}
@@ -0,0 +1,177 @@
+package unicon_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+// consulKV is a stand-in for the KV endpoints of a Consul agent
+type consulKV struct {
+	mu      sync.Mutex
+	index   uint64
+	keys    map[string]string
+	changed chan struct{}
+	token   string
+	queries chan string
+}
+
+func newConsulKV(token string, keys map[string]string) *consulKV {
+	return &consulKV{index: 10, keys: keys, changed: make(chan struct{}), token: token, queries: make(chan string, 10)}
+}
+
+func (kv *consulKV) Put(key, value string) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.keys[key] = value
+	kv.index++
+	close(kv.changed)
+	kv.changed = make(chan struct{})
+}
+
+func (kv *consulKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != kv.token {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+	select {
+	case kv.queries <- r.URL.RawQuery:
+	default:
+	}
+	prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	if index, err := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); err == nil {
+		wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+		kv.mu.Lock()
+		current, changed := kv.index, kv.changed
+		kv.mu.Unlock()
+		if current == index {
+			select {
+			case <-changed:
+			case <-time.After(wait):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(kv.index, 10))
+	var pairs []map[string]interface{}
+	for key, value := range kv.keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		pair := map[string]interface{}{"Key": key, "Value": nil}
+		if !strings.HasSuffix(key, "/") {
+			pair["Value"] = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+		pairs = append(pairs, pair)
+	}
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i]["Key"].(string) < pairs[j]["Key"].(string) })
+	json.NewEncoder(w).Encode(pairs)
+}
+
+var _ = Describe("ConsulConfig", func() {
+	var (
+		kv     *consulKV
+		server *httptest.Server
+	)
+
+	BeforeEach(func() {
+		kv = newConsulKV("acl-token", map[string]string{
+			"app/":                 "",
+			"app/db/host":          "localhost",
+			"app/db/port":          "5432",
+			"app/servers":          `["a","b"]`,
+			"app/limits":           `{"rps":100}`,
+			"application/stranger": "x",
+		})
+		server = httptest.NewServer(kv)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newConfig := func() *ConsulConfig {
+		cfg := NewConsulConfig(server.URL, "app")
+		cfg.Token = "acl-token"
+		return cfg
+	}
+
+	It("Should read the keys below the prefix", func() {
+		cfg := newConfig()
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("db.host")).To(Equal("localhost"))
+		Expect(cfg.GetInt("db.port")).To(Equal(5432))
+		Expect(cfg.Get("servers[1]")).To(Equal("b"))
+		Expect(cfg.Get("servers.length")).To(Equal(2))
+		Expect(cfg.GetInt("limits.rps")).To(Equal(100))
+		Expect(cfg.Get("stranger")).To(BeNil())
+		Expect(cfg.All()).To(HaveLen(6))
+		Expect(cfg.Source("db.host")).To(Equal("app/db/host"))
+		Expect(cfg.Index()).To(Equal(uint64(10)))
+	})
+
+	It("Should send the ACL token", func() {
+		cfg := newConfig()
+		cfg.Token = "wrong"
+		Expect(cfg.Load()).To(MatchError(ContainSubstring("403")))
+	})
+
+	It("Should load nothing from a missing prefix", func() {
+		cfg := NewConsulConfig(server.URL, "missing/")
+		cfg.Token = "acl-token"
+		cfg.Set("stale", true)
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.All()).To(BeEmpty())
+	})
+
+	It("Should wait for changes with blocking queries", func() {
+		cfg := newConfig()
+		Expect(cfg.Load()).To(Succeed())
+		Eventually(kv.queries).Should(Receive(Equal("recurse=true")))
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			kv.Put("app/db/host", "db.example.com")
+		}()
+		Expect(cfg.LongPoll(context.Background(), 10*time.Second)).To(Succeed())
+		Eventually(kv.queries).Should(Receive(Equal("index=10&recurse=true&wait=10s")))
+		Expect(cfg.Get("db.host")).To(Equal("db.example.com"))
+		Expect(cfg.Index()).To(Equal(uint64(11)))
+	})
+
+	It("Should be refreshed with blocking queries", func() {
+		cfg := newConfig()
+		Expect(cfg.Load()).To(Succeed())
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		r := NewRefresher(cfg, time.Hour)
+		r.LongPoll = 10 * time.Second
+		go func() {
+			defer close(done)
+			r.Run(ctx)
+		}()
+		kv.Put("app/db/port", "6543")
+		Eventually(func() int { return cfg.GetInt("db.port") }).Should(Equal(6543))
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+})
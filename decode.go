@@ -0,0 +1,114 @@
+package unicon
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DecodeFunc decodes a string value read from the environment or the
+// command line into a typed value.  Maps and slices are flattened into
+// nested keys like the values of a JSONConfig.
+type DecodeFunc func(value string) (interface{}, error)
+
+// ValueDecoder turns the string values read by EnvConfig, ArgvConfig and
+// PflagConfig into typed values.  Values that hold a json object or array,
+// such as APP_SERVERS='["a","b"]', are decoded as json, the other values
+// with DecodeScalar.
+type ValueDecoder struct {
+	// Separator, if set, splits the values that aren't json into lists, so
+	// with Separator "," APP_PORTS=80,443 becomes ports[0] and ports[1]
+	Separator string
+	// Keys maps keys to the DecodeFunc used for their values instead of the
+	// default decoding
+	Keys map[string]DecodeFunc
+}
+
+// DecodeString keeps the value as a string
+func DecodeString(value string) (interface{}, error) {
+	return value, nil
+}
+
+// DecodeScalar decodes true and false as booleans and numbers as int or
+// float64.  Numbers are only decoded if they are written the way Go prints
+// them, so that values such as 007 or 1.10 stay strings.
+func DecodeScalar(value string) (interface{}, error) {
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if i, err := strconv.Atoi(value); err == nil && strconv.Itoa(i) == value {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == value {
+		return f, nil
+	}
+	return value, nil
+}
+
+// DecodeJSON decodes the value as json
+func DecodeJSON(value string) (interface{}, error) {
+	var out interface{}
+	if err := json.Unmarshal([]byte(value), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DecodeList returns a DecodeFunc that splits values on sep
+func DecodeList(sep string) DecodeFunc {
+	return func(value string) (interface{}, error) {
+		var items []interface{}
+		for _, item := range strings.Split(value, sep) {
+			items = append(items, strings.TrimSpace(item))
+		}
+		return items, nil
+	}
+}
+
+func (vd *ValueDecoder) keyFunc(key string) DecodeFunc {
+	if fn, ok := vd.Keys[key]; ok {
+		return fn
+	}
+	for k, fn := range vd.Keys {
+		if strings.EqualFold(k, key) {
+			return fn
+		}
+	}
+	return nil
+}
+
+// Decode decodes the value of key
+func (vd *ValueDecoder) Decode(key, value string) (interface{}, error) {
+	if fn := vd.keyFunc(key); fn != nil {
+		return fn(value)
+	}
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		if out, err := DecodeJSON(trimmed); err == nil {
+			return out, nil
+		}
+	}
+	if vd.Separator != "" && strings.Contains(value, vd.Separator) {
+		return DecodeList(vd.Separator)(value)
+	}
+	return DecodeScalar(value)
+}
+
+// decodeValue decodes value with decoder, if it isn't nil, and flattens the
+// result under key into out
+func decodeValue(decoder *ValueDecoder, key, value string, out map[string]interface{}) error {
+	if decoder == nil {
+		out[key] = value
+		return nil
+	}
+	decoded, err := decoder.Decode(key, value)
+	if err != nil {
+		return fmt.Errorf("unicon: decoding %s: %v", key, err)
+	}
+	unmarshal(decoded, key, out)
+	return nil
+}
@@ -0,0 +1,83 @@
+package unicon_test
+
+import (
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+var _ = Describe("ValueDecoder", func() {
+	var decoder *ValueDecoder
+
+	BeforeEach(func() {
+		decoder = &ValueDecoder{Separator: ","}
+	})
+
+	It("Should decode json objects and arrays", func() {
+		Expect(decoder.Decode("a", `["a","b"]`)).To(Equal([]interface{}{"a", "b"}))
+		Expect(decoder.Decode("a", ` {"b":1} `)).To(Equal(map[string]interface{}{"b": 1.0}))
+	})
+
+	It("Should keep invalid json and plain values as strings", func() {
+		decoder.Separator = ""
+		Expect(decoder.Decode("a", `[not json`)).To(Equal("[not json"))
+		Expect(decoder.Decode("a", `80,443`)).To(Equal("80,443"))
+	})
+
+	It("Should split delimited lists", func() {
+		Expect(decoder.Decode("a", "80, 443")).To(Equal([]interface{}{"80", "443"}))
+		Expect(decoder.Decode("a", "web")).To(Equal("web"))
+	})
+
+	It("Should decode booleans and numbers", func() {
+		Expect(decoder.Decode("debug", "true")).To(Equal(true))
+		Expect(decoder.Decode("debug", "false")).To(Equal(false))
+		Expect(decoder.Decode("port", "80")).To(Equal(80))
+		Expect(decoder.Decode("port", "-1")).To(Equal(-1))
+		Expect(decoder.Decode("ratio", "0.5")).To(Equal(0.5))
+		Expect(decoder.Decode("debug", "True")).To(Equal("True"))
+		Expect(decoder.Decode("zip", "007")).To(Equal("007"))
+		Expect(decoder.Decode("version", "1.10")).To(Equal("1.10"))
+		Expect(decoder.Decode("id", "99999999999999999999")).To(Equal("99999999999999999999"))
+	})
+
+	It("Should use the decoder registered for a key", func() {
+		decoder.Keys = map[string]DecodeFunc{
+			"DSN": DecodeString,
+			"port": func(value string) (interface{}, error) {
+				return strconv.Atoi(value)
+			},
+		}
+		Expect(decoder.Decode("dsn", "a=1,b=2")).To(Equal("a=1,b=2"))
+		Expect(decoder.Decode("port", "80")).To(Equal(80))
+		_, err := decoder.Decode("port", "eighty")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should expand env values into nested keys", func() {
+		env := NewEnvConfigFrom(EnvList{
+			`APP_SERVERS=["a","b"]`,
+			`APP_DB={"host":"localhost","port":5432}`,
+			`APP_PORTS=80,443`,
+			`APP_NAME=plain`,
+			`APP_DEBUG=true`,
+		}, "APP_")
+		env.Decoder = decoder
+		Expect(env.Load()).To(Succeed())
+		Expect(env.Get("servers[1]")).To(Equal("b"))
+		Expect(env.GetInt("servers.length")).To(Equal(2))
+		Expect(env.GetInt("db.port")).To(Equal(5432))
+		Expect(env.GetInt("ports[1]")).To(Equal(443))
+		Expect(env.Get("name")).To(Equal("plain"))
+		Expect(env.Get("debug")).To(Equal(true))
+	})
+
+	It("Should fail Load when a key decoder fails", func() {
+		decoder.Keys = map[string]DecodeFunc{"port": DecodeJSON}
+		env := NewEnvConfigFrom(EnvList{"APP_PORT=eighty"}, "APP_")
+		env.Decoder = decoder
+		Expect(env.Load()).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,132 @@
+package unicon
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// backupSuffixes are the suffixes of editor and package manager leftovers
+// that DirConfig never loads
+var backupSuffixes = []string{
+	"~", ".bak", ".old", ".orig", ".swp", ".tmp",
+	".dpkg-old", ".dpkg-dist", ".dpkg-new", ".rpmsave", ".rpmnew",
+}
+
+// DirConfig is a configurable backed by a conf.d style directory.  Every
+// file in the directory is loaded in lexical order with later files
+// overriding the keys of earlier ones.  An array or a value in a later file
+// replaces the whole array or object of an earlier one.
+type DirConfig struct {
+	Configurable
+	Path string
+	// Pattern is an optional glob, such as "*.json", that files must match
+	// to be loaded.  Only the files with a registered codec are loaded,
+	// matching files without one are skipped.
+	Pattern string
+	// FS to read Path from instead of the OS filesystem
+	FS fs.FS
+	// mu guards sources, which Load replaces along with the values
+	mu      sync.Mutex
+	sources map[string]string
+}
+
+// Ensure DirConfig implements SourcedConfig
+var _ SourcedConfig = (*DirConfig)(nil)
+
+// NewDirConfig returns a new ReadableConfig backed by the files in the
+// directory at path, optionally limited to files matching pattern.
+func NewDirConfig(path string, pattern ...string) *DirConfig {
+	conf := &DirConfig{
+		Configurable: NewMemoryConfig(),
+		Path:         path,
+	}
+	if len(pattern) > 0 {
+		conf.Pattern = pattern[0]
+	}
+	LoadConfig(conf)
+	return conf
+}
+
+func ignoredFile(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "#") {
+		return true
+	}
+	for _, suffix := range backupSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// files returns the paths of the fragments to load in lexical order
+func (dc *DirConfig) files() ([]string, error) {
+	entries, err := fileSystem{dc.FS}.ReadDir(dc.Path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || ignoredFile(name) {
+			continue
+		}
+		if dc.Pattern != "" {
+			matched, err := filepath.Match(dc.Pattern, name)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+		}
+		if _, ok := LookupCodec(filepath.Ext(name)); !ok {
+			continue
+		}
+		files = append(files, fileSystem{dc.FS}.Join(dc.Path, name))
+	}
+	return files, nil
+}
+
+// Load reads every fragment in DirConfig.Path and replaces the contents of
+// the underlaying Configurable with the merged result, so fragments added
+// or removed since the previous Load are picked up.
+func (dc *DirConfig) Load() error {
+	files, err := dc.files()
+	if err != nil {
+		return err
+	}
+	merged := make(map[string]interface{})
+	sources := make(map[string]string)
+	for _, file := range files {
+		codec, err := CodecForPath(file)
+		if err != nil {
+			return err
+		}
+		loaded, err := loadFile(fileSystem{dc.FS}, file, codec)
+		if err != nil {
+			return err
+		}
+		for _, key := range mergeFlat(merged, loaded.values) {
+			delete(sources, strings.ToLower(key))
+		}
+		for key := range loaded.values {
+			sources[strings.ToLower(key)] = loaded.Source(key)
+		}
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.Configurable.Reset(merged)
+	dc.sources = sources
+	return nil
+}
+
+// Source returns the path of the fragment that supplied key
+func (dc *DirConfig) Source(key string) string {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.sources[strings.ToLower(key)]
+}
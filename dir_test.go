@@ -0,0 +1,99 @@
+package unicon_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+var _ = Describe("DirConfig", func() {
+	var (
+		dir string
+		cfg *DirConfig
+	)
+
+	write := func(name, content string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "unicon-conf.d")
+		Expect(err).ToNot(HaveOccurred())
+		write("10-base.json", `{"a":1,"b":{"c":"base"}}`)
+		write("20-override.json", `{"b":{"c":"override"}}`)
+		write(".hidden.json", `{"a":"hidden"}`)
+		write("30-backup.json~", `{"a":"backup"}`)
+		write("40-old.json.bak", `{"a":"bak"}`)
+		write("README", `not config`)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("Should merge fragments in lexical order", func() {
+		cfg = NewDirConfig(dir)
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.GetInt("a")).To(Equal(1))
+		Expect(cfg.Get("b.c")).To(Equal("override"))
+	})
+
+	It("Should remember which fragment supplied each key", func() {
+		cfg = NewDirConfig(dir)
+		Expect(cfg.Source("a")).To(Equal(filepath.Join(dir, "10-base.json")))
+		Expect(cfg.Source("B.C")).To(Equal(filepath.Join(dir, "20-override.json")))
+		Expect(cfg.Source("missing")).To(Equal(""))
+	})
+
+	It("Should pick up added and removed fragments on Load", func() {
+		cfg = NewDirConfig(dir)
+		write("15-added.json", `{"d":true}`)
+		os.Remove(filepath.Join(dir, "20-override.json"))
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("d")).To(Equal(true))
+		Expect(cfg.Get("b.c")).To(Equal("base"))
+	})
+
+	It("Should only load files matching the pattern", func() {
+		write("05-extra.kv", "a=kv\n")
+		RegisterCodec("kv", kvCodec{})
+		cfg = NewDirConfig(dir)
+		Expect(cfg.Get("a")).To(Equal(1.0))
+		Expect(cfg.Source("a")).To(Equal(filepath.Join(dir, "10-base.json")))
+
+		cfg = NewDirConfig(dir, "*.kv")
+		Expect(cfg.Get("a")).To(Equal("kv"))
+		Expect(cfg.Get("b.c")).To(BeNil())
+	})
+
+	It("Should replace the arrays and objects of earlier fragments", func() {
+		write("11-servers.json", `{"servers":["a","b","c"],"tls":{"cert":"c.pem"}}`)
+		write("12-servers.json", `{"servers":["d"],"tls":false}`)
+		cfg = NewDirConfig(dir)
+		Expect(cfg.Get("servers[0]")).To(Equal("d"))
+		Expect(cfg.Get("servers[1]")).To(BeNil())
+		Expect(cfg.Get("servers.length")).To(Equal(1))
+		Expect(cfg.Get("tls")).To(Equal(false))
+		Expect(cfg.Get("tls.cert")).To(BeNil())
+		Expect(cfg.Source("servers[0]")).To(Equal(filepath.Join(dir, "12-servers.json")))
+	})
+
+	It("Should skip files matching the pattern without a codec", func() {
+		write("50-notes.txt", `not config`)
+		cfg = NewDirConfig(dir, "*0-*")
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("b.c")).To(Equal("override"))
+	})
+
+	It("Should error when a fragment fails to decode", func() {
+		write("50-invalid.json", `{`)
+		cfg = NewDirConfig(dir)
+		Expect(cfg.Load()).ToNot(Succeed())
+	})
+})
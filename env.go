@@ -5,18 +5,102 @@ import (
 	"strings"
 )
 
+// Environment is the source of the variables read by EnvConfig
+type Environment interface {
+	// Environ returns the variables as KEY=value pairs
+	Environ() []string
+	// LookupEnv returns the value of a single variable
+	LookupEnv(name string) (string, bool)
+}
+
+// osEnvironment is the environment of the process
+type osEnvironment struct{}
+
+func (osEnvironment) Environ() []string {
+	return os.Environ()
+}
+
+func (osEnvironment) LookupEnv(name string) (string, bool) {
+	return os.LookupEnv(name)
+}
+
+// EnvList is an Environment backed by a list of KEY=value pairs, in the
+// format of os.Environ()
+type EnvList []string
+
+// Environ returns the list
+func (el EnvList) Environ() []string {
+	return el
+}
+
+// LookupEnv returns the value of the last pair for name, like the process
+// environment does for duplicates
+func (el EnvList) LookupEnv(name string) (string, bool) {
+	for i := len(el) - 1; i >= 0; i-- {
+		kv := strings.SplitN(el[i], "=", 2)
+		if len(kv) == 2 && kv[0] == name {
+			return kv[1], true
+		}
+	}
+	return "", false
+}
+
+// EnvLookup is an Environment backed by a lookup function.  It can't list
+// its variables, so only the variables bound with BindEnv are read.
+type EnvLookup func(name string) (string, bool)
+
+// Environ returns nothing, a lookup function can't be listed
+func (EnvLookup) Environ() []string {
+	return nil
+}
+
+// LookupEnv calls the function
+func (fn EnvLookup) LookupEnv(name string) (string, bool) {
+	return fn(name)
+}
+
+// envBinding binds a key to the variables tried in order for its value
+type envBinding struct {
+	key   string
+	names []string
+}
+
 // EnvConfig can be used to read values from the environment
 // into the underlaying Configurable
 type EnvConfig struct {
 	Configurable
-	Prefix     string
+	// Env is the environment to read, the process environment if nil
+	Env Environment
+	// Prefix, if set, limits the variables imported to the ones that start
+	// with it, and is removed from their names
+	Prefix string
+	// ImportUnprefixed also imports the variables without the Prefix, under
+	// their whole name
+	ImportUnprefixed bool
+	// Delimiter, if set, is replaced by "." in variable names to nest keys,
+	// with Prefix "APP_" and Delimiter "__" APP_DB__HOST becomes DB.HOST
+	Delimiter string
+	// KeyMapper, if set, replaces the Prefix, Delimiter and namespace
+	// handling.  It is called with the name of every variable and returns
+	// the key to import it as, or false to skip the variable.
+	KeyMapper func(name string) (key string, ok bool)
+	// Decoder, if set, decodes the values into typed values
+	Decoder    *ValueDecoder
 	namespaces []string
+	bindings   []envBinding
 }
 
 // NewEnvConfig creates a new Env config backed by a memory config
-func NewEnvConfig(prefix string, namespaces ...string) ReadableConfig {
+func NewEnvConfig(prefix string, namespaces ...string) *EnvConfig {
+	return NewEnvConfigFrom(nil, prefix, namespaces...)
+}
+
+// NewEnvConfigFrom creates a new Env config that reads env instead of the
+// process environment, such as EnvList{"APP_PORT=80"} in tests
+func NewEnvConfigFrom(env Environment, prefix string, namespaces ...string) *EnvConfig {
 	cfg := &EnvConfig{
 		Configurable: NewMemoryConfig(),
+		Env:          env,
 		Prefix:       prefix,
 		namespaces:   nsSlice(namespaces),
 	}
@@ -24,20 +108,92 @@ func NewEnvConfig(prefix string, namespaces ...string) ReadableConfig {
 	return cfg
 }
 
-// Load loads the data from os.Environ() to the underlaying Configurable.
+func (ec *EnvConfig) env() Environment {
+	if ec.Env == nil {
+		return osEnvironment{}
+	}
+	return ec.Env
+}
+
+// BindEnv binds key to the variables in names, which need not share the
+// Prefix.  The first variable that is set supplies the value, so
+// BindEnv("db.url", "DATABASE_URL", "PG_URL") prefers DATABASE_URL.
+// Bindings take precedence over the keys derived from variable names.
+func (ec *EnvConfig) BindEnv(key string, names ...string) {
+	binding := envBinding{key: key, names: names}
+	ec.bindings = append(ec.bindings, binding)
+	if value, ok := binding.lookup(ec.env()); ok {
+		values := make(map[string]interface{})
+		if err := decodeValue(ec.Decoder, key, value, values); err == nil {
+			ec.BulkSet(values)
+		}
+	}
+}
+
+func (eb envBinding) lookup(env Environment) (string, bool) {
+	for _, name := range eb.names {
+		if value, ok := env.LookupEnv(name); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// key maps the name of a variable to its key
+func (ec *EnvConfig) key(name string) (string, bool) {
+	if ec.KeyMapper != nil {
+		return ec.KeyMapper(name)
+	}
+	if ec.Prefix != "" {
+		if strings.HasPrefix(name, ec.Prefix) {
+			name = strings.TrimPrefix(name, ec.Prefix)
+		} else if !ec.ImportUnprefixed {
+			return "", false
+		}
+	}
+	if name == "" {
+		return "", false
+	}
+	if ec.Delimiter != "" {
+		name = strings.Replace(name, ec.Delimiter, ".", -1)
+	}
+	return namespaceKey(name, ec.namespaces), true
+}
+
+// Load loads the data from EnvConfig.Env, os.Environ() by default, to the
+// underlaying Configurable.
 // if a Prefix is set then variables are imported with self.Prefix removed from the name
 // so MYAPP_test=1 exported in env and read from ENV by EnvConfig{Prefix:"MYAPP_"} can be found from
 // EnvConfig.Get("test")
 // If namespaces are declared, POSTGRESQL_HOST becomes postgresql.host
+// Variables without the Prefix are skipped unless ImportUnprefixed is set.
 func (ec *EnvConfig) Load() (err error) {
-	env := os.Environ()
-	for _, pair := range env {
-		kv := strings.Split(pair, "=")
-		if kv != nil && len(kv) >= 2 {
-			name := strings.Replace(kv[0], ec.Prefix, "", 1)
-			name = namespaceKey(name, ec.namespaces)
-			ec.Set(name, kv[1])
+	env := ec.env()
+	values := make(map[string]interface{})
+	for _, pair := range env.Environ() {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if name, ok := ec.key(kv[0]); ok {
+			if err := decodeValue(ec.Decoder, name, kv[1], values); err != nil {
+				return err
+			}
+		}
+	}
+	for _, binding := range ec.bindings {
+		if value, ok := binding.lookup(env); ok {
+			for name := range values {
+				// the binding replaces the key in any casing and its children
+				if isKeyOrChild(name, binding.key) {
+					delete(values, name)
+				}
+			}
+			if err := decodeValue(ec.Decoder, binding.key, value, values); err != nil {
+				return err
+			}
 		}
 	}
+	ec.Reset(values)
 	return nil
 }
@@ -19,12 +19,17 @@ var _ = Describe("EnvConfig", func() {
 		err = cfg.Load()
 		Expect(err).ToNot(HaveOccurred())
 	})
+	AfterEach(func() {
+		for _, name := range []string{"POSTGRES_HOST", "POSTGRES-HOST", "POSTGRES:HOST"} {
+			os.Unsetenv(name)
+		}
+	})
 	It("Should load variables from environment", func() {
 		Expect(len(cfg.All()) > 0).To(BeTrue())
 		env := os.Environ()
 		Expect(len(env) > 0).To(BeTrue())
 		for _, kvpair := range env {
-			pairs := strings.Split(kvpair, "=")
+			pairs := strings.SplitN(kvpair, "=", 2)
 			Expect(len(pairs) >= 2).To(BeTrue())
 			Expect(cfg.Get(strings.ToLower(pairs[0]))).To(Equal(pairs[1]))
 		}
@@ -53,6 +58,75 @@ var _ = Describe("EnvConfig", func() {
 		cfg.Load()
 		Expect(cfg.Get("postgres.host")).To(Equal("localhost"))
 	})
+	It("Should only split on the first =", func() {
+		cfg = NewEnvConfigFrom(EnvList{"UNICON_TEST_DSN=user=a password=b"}, "UNICON_TEST_")
+		Expect(cfg.Get("dsn")).To(Equal("user=a password=b"))
+	})
+	It("Should only strip the prefix from the start of names", func() {
+		env := NewEnvConfigFrom(EnvList{"OTHER_UNICON_TEST_A=1"}, "UNICON_TEST_")
+		env.ImportUnprefixed = true
+		Expect(env.Load()).To(Succeed())
+		Expect(env.Get("other_unicon_test_a")).To(Equal("1"))
+		Expect(env.Get("other_a")).To(BeNil())
+	})
+	It("Should only import prefixed variables", func() {
+		cfg = NewEnvConfigFrom(EnvList{"UNICON_TEST_A=1", "PATH=/bin"}, "UNICON_TEST_")
+		Expect(cfg.Get("a")).To(Equal("1"))
+		Expect(cfg.Get("PATH")).To(BeNil())
+		Expect(cfg.Get("unicon_test_a")).To(BeNil())
+	})
+	It("Should nest keys on the delimiter", func() {
+		env := &EnvConfig{
+			Configurable: NewMemoryConfig(),
+			Env:          EnvList{"UNICON_TEST_DB__HOST=localhost"},
+			Prefix:       "UNICON_TEST_",
+			Delimiter:    "__",
+		}
+		Expect(env.Load()).To(Succeed())
+		Expect(env.Get("db.host")).To(Equal("localhost"))
+	})
+	It("Should map keys with the KeyMapper", func() {
+		env := &EnvConfig{
+			Configurable: NewMemoryConfig(),
+			Env:          EnvList{"UNICON_TEST_MAPPED=yes", "PATH=/bin"},
+			KeyMapper: func(name string) (string, bool) {
+				if name == "UNICON_TEST_MAPPED" {
+					return "mapped.key", true
+				}
+				return "", false
+			},
+		}
+		Expect(env.Load()).To(Succeed())
+		Expect(env.All()).To(Equal(map[string]interface{}{"mapped.key": "yes"}))
+	})
+	It("Should read an injected environment", func() {
+		env := NewEnvConfigFrom(EnvList{"APP_PORT=80", "APP_PORT=8080", "PATH=/bin"}, "APP_")
+		Expect(env.Load()).To(Succeed())
+		Expect(env.All()).To(Equal(map[string]interface{}{"PORT": "8080"}))
+	})
+	It("Should bind keys to variables tried in order", func() {
+		env := NewEnvConfigFrom(EnvList{"PG_URL=pg", "APP_DB.URL=app"}, "APP_")
+		env.BindEnv("db.url", "DATABASE_URL", "PG_URL")
+		Expect(env.Get("db.url")).To(Equal("pg"))
+		Expect(env.Load()).To(Succeed())
+		Expect(env.Get("db.url")).To(Equal("pg"))
+		Expect(env.Get("pg_url")).To(BeNil())
+
+		env.Env = EnvList{"DATABASE_URL=database", "PG_URL=pg"}
+		Expect(env.Load()).To(Succeed())
+		Expect(env.Get("db.url")).To(Equal("database"))
+	})
+	It("Should read bindings from a lookup function", func() {
+		lookup := EnvLookup(func(name string) (string, bool) {
+			if name == "DATABASE_URL" {
+				return "lookup", true
+			}
+			return "", false
+		})
+		env := NewEnvConfigFrom(lookup, "")
+		env.BindEnv("db.url", "DATABASE_URL")
+		Expect(env.All()).To(Equal(map[string]interface{}{"db.url": "lookup"}))
+	})
 	It("Should create namespaces if provided, split by :", func() {
 		os.Setenv("POSTGRES:HOST", "localhost")
 		cfg = NewEnvConfig("", "postgres")
@@ -7,7 +7,7 @@ import (
 	. "github.com/taybin/unicon"
 )
 
-func ExampleHierarchy() {
+func Example_hierarchy() {
 	conf := NewConfig(nil)             // root config
 	conf.Use("second", NewConfig(nil)) // config in hierarchy as second
 	conf.Use("second").Set("asd", "abc")
@@ -15,7 +15,7 @@ func ExampleHierarchy() {
 	// Output: abc
 }
 
-func ExampleDefaults() {
+func Example_defaults() {
 	conf := NewConfig(nil) // root config
 	conf.ResetDefaults(map[string]interface{}{
 		"test_default":   "123",
@@ -27,7 +27,7 @@ func ExampleDefaults() {
 	// Output: 333 321
 }
 
-func ExampleSaveToJSON() {
+func Example_saveToJSON() {
 	conf := NewConfig(nil)
 	conf.Set("some", "variable")
 	jsonconf := NewJSONConfig("./config.json", conf)
@@ -49,7 +49,7 @@ func ExampleSaveToJSON() {
 	// Output: variable
 }
 
-func ExampleConstruction() {
+func Example_construction() {
 	var cfg MemoryConfig
 	cfg.Set("example1", "123")
 	fmt.Println(cfg.Get("example1"))
@@ -0,0 +1,144 @@
+package unicon
+
+import (
+	"io/fs"
+	"sync"
+)
+
+// FileConfig is a configurable backed by a file in any format with a
+// registered Codec
+type FileConfig struct {
+	Configurable
+	Path string
+	// Codec used to read and write Path, if nil the codec is picked by the
+	// extension of Path
+	Codec Codec
+	// FS to read Path from instead of the OS filesystem, configs read from
+	// an FS can't be saved
+	FS fs.FS
+	// Backups is the number of previous versions Save keeps as Path.1,
+	// Path.2 and so on
+	Backups int
+	// mu guards loaded, which Load replaces along with the values
+	mu      sync.Mutex
+	loaded  *loadedFile
+	changes changes
+}
+
+// Ensure FileConfig implements SourcedConfig and PendingConfig
+var (
+	_ SourcedConfig = (*FileConfig)(nil)
+	_ PendingConfig = (*FileConfig)(nil)
+)
+
+// NewFileConfig returns a new WritableConfig backed by the file at path.
+// The codec is chosen from the file extension unless one is passed
+// explicitly.  The file does not need to exist, if it does not exist the
+// first Save call will create it.
+func NewFileConfig(path string, codec ...Codec) *FileConfig {
+	conf := &FileConfig{
+		Configurable: NewMemoryConfig(),
+		Path:         path,
+	}
+	if len(codec) > 0 {
+		conf.Codec = codec[0]
+	}
+	LoadConfig(conf)
+	return conf
+}
+
+func (fc *FileConfig) codec() (Codec, error) {
+	if fc.Codec != nil {
+		return fc.Codec, nil
+	}
+	return CodecForPath(fc.Path)
+}
+
+// Load attempts to load the file at FileConfig.Path, along with the files
+// it includes, and Set its contents into the underlaying Configurable
+// Changes that haven't been saved yet are kept on top of the loaded values
+// and stay pending.
+func (fc *FileConfig) Load() (err error) {
+	codec, err := fc.codec()
+	if err != nil {
+		return
+	}
+	loaded, err := loadFile(fileSystem{fc.FS}, fc.Path, codec)
+	if err != nil {
+		return
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.changes.reload(fc.Configurable, loaded.values)
+	fc.loaded = loaded
+	return
+}
+
+// Source returns the file that supplied key, which is an included file
+// rather than FileConfig.Path if the key came from an $include directive
+func (fc *FileConfig) Source(key string) string {
+	return fc.loadedFile().Source(key)
+}
+
+// loadedFile returns the file as of the last Load
+func (fc *FileConfig) loadedFile() *loadedFile {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.loaded
+}
+
+// Save attempts to save the configuration from the underlaying Configurable
+// to the file at FileConfig.Path.  The file is replaced atomically, see
+// Backups to keep previous versions.  The flattened keys are nested back into
+// maps and arrays before they are encoded.  Keys that still hold the value
+// loaded from an included file are not copied into FileConfig.Path.
+func (fc *FileConfig) Save() (err error) {
+	codec, err := fc.codec()
+	if err != nil {
+		return err
+	}
+	snapshot := fc.changes.snapshot()
+	b, err := codec.Encode(nest(fc.loadedFile().prune(fc.Configurable.All())))
+	if err != nil {
+		return err
+	}
+
+	fsys := fileSystem{fc.FS}
+	if err := fsys.WriteFile(fc.Path, b, fc.Backups); err != nil {
+		return err
+	}
+	fc.changes.clean(snapshot)
+	return nil
+}
+
+// Set a key to value, the change is pending until the next Save
+func (fc *FileConfig) Set(key string, value interface{}) {
+	fc.Configurable.Set(key, value)
+	fc.changes.touch(key)
+}
+
+// BulkSet overwrites items with the provided map, the changes are pending
+// until the next Save
+func (fc *FileConfig) BulkSet(items map[string]interface{}) {
+	fc.Configurable.BulkSet(items)
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	fc.changes.touch(keys...)
+}
+
+// Reset the data to the provided data, the change is pending until the next
+// Save
+func (fc *FileConfig) Reset(datas ...map[string]interface{}) {
+	fc.Configurable.Reset(datas...)
+	fc.changes.touchAll()
+}
+
+// Pending reports whether there are changes that haven't been saved.  It
+// is also true until the file was loaded or saved once, so that Save
+// creates a missing file.
+func (fc *FileConfig) Pending() bool {
+	return fc.changes.pending()
+}
@@ -0,0 +1,101 @@
+package unicon_test
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+// kvCodec is a line based key=value codec used to test codec registration
+type kvCodec struct{}
+
+func (kvCodec) Decode(data []byte) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		out[kv[0]] = kv[1]
+	}
+	return out, nil
+}
+
+func (kvCodec) Encode(data map[string]interface{}) ([]byte, error) {
+	lines := kvLines("", data)
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+func kvLines(prefix string, data map[string]interface{}) (lines []string) {
+	for k, v := range data {
+		if nested, ok := v.(map[string]interface{}); ok {
+			lines = append(lines, kvLines(prefix+k+".", nested)...)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s%s=%v", prefix, k, v))
+	}
+	return
+}
+
+var _ = Describe("FileConfig", func() {
+	var (
+		err error
+		cfg WritableConfig
+	)
+
+	BeforeEach(func() {
+		RegisterCodec(".kv", kvCodec{})
+	})
+
+	It("Should pick the codec from the extension", func() {
+		cfg = NewFileConfig("./config_valid.json")
+		err = cfg.Load()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg.Get("test")).To(Equal("123"))
+		Expect(cfg.GetInt("test_object.nested_int")).To(Equal(987))
+	})
+
+	It("Should use a registered codec", func() {
+		cfg = NewFileConfig("./config_test.kv")
+		cfg.Set("a", "1")
+		cfg.Set("b.c", "2")
+		Expect(cfg.Save()).To(Succeed())
+		defer os.Remove("./config_test.kv")
+
+		cfg2 := NewFileConfig("./config_test.kv")
+		Expect(cfg2.Load()).To(Succeed())
+		Expect(cfg2.Get("a")).To(Equal("1"))
+		Expect(cfg2.Get("b.c")).To(Equal("2"))
+	})
+
+	It("Should use an explicit codec regardless of extension", func() {
+		cfg = NewFileConfig("./config_test.conf", kvCodec{})
+		cfg.Set("a", "1")
+		Expect(cfg.Save()).To(Succeed())
+		defer os.Remove("./config_test.conf")
+
+		cfg2 := NewFileConfig("./config_test.conf", kvCodec{})
+		Expect(cfg2.Load()).To(Succeed())
+		Expect(cfg2.Get("a")).To(Equal("1"))
+	})
+
+	It("Should error on an unknown extension", func() {
+		cfg = NewFileConfig("./config_test.unknown")
+		Expect(cfg.Load()).ToNot(Succeed())
+		Expect(cfg.Save()).ToNot(Succeed())
+	})
+
+	It("Should error when the file fails to decode", func() {
+		cfg = NewFileConfig("./config_invalid.json")
+		Expect(cfg.Load()).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,208 @@
+package unicon
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+)
+
+// flagKeyAnnotation is the pflag annotation RegisterFlags stores the key of
+// a flag in
+const flagKeyAnnotation = "unicon.key"
+
+// scalarIndex matches the index of an array element that isn't an object or
+// another array
+var scalarIndex = regexp.MustCompile(`^\[\d+\]$`)
+
+// FlagOptions configures the flags created by RegisterFlags
+type FlagOptions struct {
+	// Prefix is prepended to the flag names
+	Prefix string
+	// Separator, if set, replaces "." in the flag names so that with
+	// Separator "-" the key db.host gets the flag --db-host.  Flag names
+	// keep the dots of the keys by default, which FlagSetConfig imports
+	// without namespaces.
+	Separator string
+	// Usage is the usage text of the flag of each key
+	Usage map[string]string
+}
+
+// flagName derives the name of the flag for key
+func (opts FlagOptions) flagName(key string) string {
+	if opts.Separator != "" {
+		key = strings.Replace(key, ".", opts.Separator, -1)
+	}
+	return opts.Prefix + key
+}
+
+// RegisterFlags defines a flag in fs for every key that has a default in
+// uni.  The type of the flag follows the type of the default, arrays of
+// scalars become string slices and other types strings.  The default of a
+// flag is the current value of the key, so it reflects the files and
+// environment loaded into uni.  Flags that are already defined in fs are
+// left alone.
+func RegisterFlags(fs *pflag.FlagSet, uni *Unicon, opts FlagOptions) {
+	defaults := make(map[string]interface{})
+	for key, value := range uni.defaults.All() {
+		if uni.prefix != "" {
+			if !strings.HasPrefix(strings.ToLower(key), strings.ToLower(uni.prefix)+".") {
+				continue
+			}
+			key = key[len(uni.prefix)+1:]
+		}
+		defaults[key] = value
+	}
+
+	// arrays are flattened, collect the keys of the arrays of scalars
+	arrays := make(map[string]bool)
+	for key := range defaults {
+		if i := strings.Index(key, "["); i >= 0 {
+			scalar, seen := arrays[key[:i]]
+			arrays[key[:i]] = (scalar || !seen) && scalarIndex.MatchString(key[i:])
+		}
+	}
+
+	keys := make([]string, 0, len(defaults))
+	for key := range defaults {
+		keys = append(keys, key)
+	}
+	for key := range arrays {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := opts.flagName(key)
+		if strings.Contains(key, "[") || fs.Lookup(name) != nil {
+			continue
+		}
+		if base := strings.TrimSuffix(key, ".length"); base != key {
+			if _, ok := arrays[base]; ok {
+				continue
+			}
+		}
+		usage := opts.Usage[key]
+		if scalar, ok := arrays[key]; ok {
+			if scalar {
+				fs.StringSlice(name, arrayValue(uni, key), usage)
+			}
+		} else {
+			defineFlag(fs, name, defaults[key], uni.Get(key), usage)
+		}
+		if fs.Lookup(name) != nil {
+			fs.SetAnnotation(name, flagKeyAnnotation, []string{key})
+		}
+	}
+}
+
+// arrayValue returns the current elements of the flattened array key
+func arrayValue(uni *Unicon, key string) []string {
+	values := make([]string, uni.GetInt(key+".length"))
+	for i := range values {
+		values[i] = uni.GetString(fmt.Sprintf("%s[%d]", key, i))
+	}
+	return values
+}
+
+// defineFlag defines the flag name typed after def with the value current,
+// or def if current can't be converted
+func defineFlag(fs *pflag.FlagSet, name string, def, current interface{}, usage string) {
+	switch def := def.(type) {
+	case bool:
+		value, err := cast.ToBoolE(current)
+		if err != nil {
+			value = def
+		}
+		fs.Bool(name, value, usage)
+	case int:
+		value, err := cast.ToIntE(current)
+		if err != nil {
+			value = def
+		}
+		fs.Int(name, value, usage)
+	case int32:
+		value, err := cast.ToInt32E(current)
+		if err != nil {
+			value = def
+		}
+		fs.Int32(name, value, usage)
+	case int64:
+		value, err := cast.ToInt64E(current)
+		if err != nil {
+			value = def
+		}
+		fs.Int64(name, value, usage)
+	case uint:
+		value, err := cast.ToUintE(current)
+		if err != nil {
+			value = def
+		}
+		fs.Uint(name, value, usage)
+	case float32:
+		value, err := cast.ToFloat32E(current)
+		if err != nil {
+			value = def
+		}
+		fs.Float32(name, value, usage)
+	case float64:
+		value, err := cast.ToFloat64E(current)
+		if err != nil {
+			value = def
+		}
+		fs.Float64(name, value, usage)
+	case time.Duration:
+		value, err := cast.ToDurationE(current)
+		if err != nil {
+			value = def
+		}
+		fs.Duration(name, value, usage)
+	default:
+		fs.String(name, cast.ToString(current), usage)
+	}
+}
+
+// PrintFlagUsage writes the usage of the flags in fs to w grouped by the
+// namespace of their keys, the first segment of the key.  The flags
+// defined by RegisterFlags also show the source of their current value in
+// uni.  Flags without a namespace are listed first.
+func PrintFlagUsage(w io.Writer, fs *pflag.FlagSet, uni *Unicon) {
+	groups := make(map[string]*pflag.FlagSet)
+	var names []string
+	fs.VisitAll(func(f *pflag.Flag) {
+		copied := *f
+		ns := ""
+		if keys := f.Annotations[flagKeyAnnotation]; len(keys) > 0 {
+			if i := strings.Index(keys[0], "."); i >= 0 {
+				ns = keys[0][:i]
+			}
+			if source := uni.Source(keys[0]); source != "" {
+				copied.Usage = strings.TrimSpace(fmt.Sprintf("%s [%s]", copied.Usage, source))
+			}
+		}
+		group, ok := groups[ns]
+		if !ok {
+			group = pflag.NewFlagSet(ns, pflag.ContinueOnError)
+			groups[ns] = group
+			names = append(names, ns)
+		}
+		group.AddFlag(&copied)
+	})
+	sort.Strings(names)
+	for i, ns := range names {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if ns == "" {
+			fmt.Fprintln(w, "Flags:")
+		} else {
+			fmt.Fprintf(w, "%s flags:\n", ns)
+		}
+		fmt.Fprint(w, groups[ns].FlagUsages())
+	}
+}
@@ -0,0 +1,94 @@
+package unicon_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+	. "github.com/taybin/unicon"
+)
+
+var _ = Describe("RegisterFlags", func() {
+	var (
+		uni *Unicon
+		fs  *pflag.FlagSet
+	)
+
+	BeforeEach(func() {
+		uni = NewConfig(nil)
+		uni.SetDefault("debug", false)
+		uni.SetDefault("db.host", "localhost")
+		uni.SetDefault("db.port", 5432)
+		uni.SetDefault("timeout", time.Second)
+		uni.SetDefault("tags", []interface{}{"a", "b"})
+		uni.Use("env", NewEnvConfigFrom(EnvList{"APP_DB_HOST=db.example.com"}, "APP_", "db"))
+		fs = pflag.NewFlagSet("app", pflag.ContinueOnError)
+	})
+
+	It("Should define a typed flag per default", func() {
+		RegisterFlags(fs, uni, FlagOptions{})
+		Expect(fs.Lookup("debug").Value.Type()).To(Equal("bool"))
+		Expect(fs.Lookup("db.port").Value.Type()).To(Equal("int"))
+		Expect(fs.Lookup("db.host").Value.Type()).To(Equal("string"))
+		Expect(fs.Lookup("timeout").Value.Type()).To(Equal("duration"))
+		Expect(fs.Lookup("tags").Value.Type()).To(Equal("stringSlice"))
+		Expect(fs.Lookup("tags.length")).To(BeNil())
+		Expect(fs.Lookup("tags[0]")).To(BeNil())
+	})
+
+	It("Should use the current value as the flag default", func() {
+		RegisterFlags(fs, uni, FlagOptions{})
+		Expect(fs.Lookup("db.host").DefValue).To(Equal("db.example.com"))
+		Expect(fs.Lookup("db.port").DefValue).To(Equal("5432"))
+		Expect(fs.Lookup("tags").DefValue).To(Equal("[a,b]"))
+	})
+
+	It("Should derive the flag names from the keys", func() {
+		RegisterFlags(fs, uni, FlagOptions{
+			Prefix:    "app-",
+			Separator: "-",
+			Usage:     map[string]string{"db.port": "database port"},
+		})
+		Expect(fs.Lookup("app-db-host")).ToNot(BeNil())
+		Expect(fs.Lookup("app-db-port").Usage).To(Equal("database port"))
+	})
+
+	It("Should leave defined flags alone", func() {
+		fs.String("debug", "custom", "")
+		RegisterFlags(fs, uni, FlagOptions{})
+		Expect(fs.Lookup("debug").DefValue).To(Equal("custom"))
+	})
+
+	It("Should round trip through FlagSetConfig", func() {
+		RegisterFlags(fs, uni, FlagOptions{})
+		Expect(fs.Parse([]string{"--db.port=6543", "--debug"})).To(Succeed())
+		flags := NewFlagSetConfig(fs, "")
+		flags.ChangedOnly = true
+		uni.Use("flags", flags)
+		Expect(uni.Get("db.port")).To(Equal(6543))
+		Expect(uni.Get("debug")).To(Equal(true))
+		Expect(uni.Get("db.host")).To(Equal("db.example.com"))
+	})
+
+	It("Should register the keys of a Sub", func() {
+		RegisterFlags(fs, uni.Sub("db"), FlagOptions{})
+		Expect(fs.Lookup("host")).ToNot(BeNil())
+		Expect(fs.Lookup("port")).ToNot(BeNil())
+		Expect(fs.Lookup("debug")).To(BeNil())
+	})
+
+	It("Should print the usage grouped by namespace with sources", func() {
+		fs.Bool("help", false, "show help")
+		RegisterFlags(fs, uni, FlagOptions{})
+		var buf bytes.Buffer
+		PrintFlagUsage(&buf, fs, uni)
+		usage := buf.String()
+		Expect(usage).To(HavePrefix("Flags:\n"))
+		Expect(usage).To(ContainSubstring("\n\ndb flags:\n"))
+		Expect(usage).To(MatchRegexp(`--db.host string +\[env\] \(default "db.example.com"\)`))
+		Expect(usage).To(MatchRegexp(`--db.port int +\[default\] \(default 5432\)`))
+		Expect(usage).To(MatchRegexp(`--help +show help\n`))
+	})
+})
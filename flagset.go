@@ -2,23 +2,205 @@ package unicon
 
 import (
 	"flag"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 )
 
+// pflagValue returns the native value of f, falling back to its string
+// form for value types it doesn't know
+func pflagValue(fs *pflag.FlagSet, f *pflag.Flag) interface{} {
+	if getter, ok := f.Value.(flag.Getter); ok {
+		return expandValue(getter.Get())
+	}
+	var value interface{}
+	var err error
+	switch f.Value.Type() {
+	case "bool":
+		value, err = fs.GetBool(f.Name)
+	case "boolSlice":
+		value, err = fs.GetBoolSlice(f.Name)
+	case "bytesBase64":
+		value, err = fs.GetBytesBase64(f.Name)
+	case "bytesHex":
+		value, err = fs.GetBytesHex(f.Name)
+	case "count":
+		value, err = fs.GetCount(f.Name)
+	case "duration":
+		value, err = fs.GetDuration(f.Name)
+	case "durationSlice":
+		value, err = fs.GetDurationSlice(f.Name)
+	case "float32":
+		value, err = fs.GetFloat32(f.Name)
+	case "float32Slice":
+		value, err = fs.GetFloat32Slice(f.Name)
+	case "float64":
+		value, err = fs.GetFloat64(f.Name)
+	case "float64Slice":
+		value, err = fs.GetFloat64Slice(f.Name)
+	case "int":
+		value, err = fs.GetInt(f.Name)
+	case "int8":
+		value, err = fs.GetInt8(f.Name)
+	case "int16":
+		value, err = fs.GetInt16(f.Name)
+	case "int32":
+		value, err = fs.GetInt32(f.Name)
+	case "int32Slice":
+		value, err = fs.GetInt32Slice(f.Name)
+	case "int64":
+		value, err = fs.GetInt64(f.Name)
+	case "int64Slice":
+		value, err = fs.GetInt64Slice(f.Name)
+	case "intSlice":
+		value, err = fs.GetIntSlice(f.Name)
+	case "ip":
+		value, err = fs.GetIP(f.Name)
+	case "ipMask":
+		value, err = fs.GetIPv4Mask(f.Name)
+	case "ipNet":
+		value, err = fs.GetIPNet(f.Name)
+	case "ipSlice":
+		value, err = fs.GetIPSlice(f.Name)
+	case "string":
+		value, err = fs.GetString(f.Name)
+	case "stringArray":
+		value, err = fs.GetStringArray(f.Name)
+	case "stringSlice":
+		value, err = fs.GetStringSlice(f.Name)
+	case "stringToInt":
+		value, err = fs.GetStringToInt(f.Name)
+	case "stringToInt64":
+		value, err = fs.GetStringToInt64(f.Name)
+	case "stringToString":
+		value, err = fs.GetStringToString(f.Name)
+	case "uint":
+		value, err = fs.GetUint(f.Name)
+	case "uint8":
+		value, err = fs.GetUint8(f.Name)
+	case "uint16":
+		value, err = fs.GetUint16(f.Name)
+	case "uint32":
+		value, err = fs.GetUint32(f.Name)
+	case "uint64":
+		value, err = fs.GetUint64(f.Name)
+	case "uintSlice":
+		value, err = fs.GetUintSlice(f.Name)
+	default:
+		return f.Value.String()
+	}
+	if err != nil {
+		return f.Value.String()
+	}
+	return expandValue(value)
+}
+
+// expandValue converts the slices and maps returned by flag values into
+// []interface{} and map[string]interface{} so that unmarshal expands them
+// into nested keys.  Byte slices, such as net.IP, and the slices and maps
+// of other types are kept as they are.
+func expandValue(value interface{}) interface{} {
+	var items []interface{}
+	switch value := value.(type) {
+	case []interface{}:
+		for _, item := range value {
+			items = append(items, expandValue(item))
+		}
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			out[key] = expandValue(item)
+		}
+		return out
+	case []string:
+		for _, item := range value {
+			items = append(items, item)
+		}
+	case []bool:
+		for _, item := range value {
+			items = append(items, item)
+		}
+	case []int:
+		for _, item := range value {
+			items = append(items, item)
+		}
+	case []int32:
+		for _, item := range value {
+			items = append(items, item)
+		}
+	case []int64:
+		for _, item := range value {
+			items = append(items, item)
+		}
+	case []uint:
+		for _, item := range value {
+			items = append(items, item)
+		}
+	case []float32:
+		for _, item := range value {
+			items = append(items, item)
+		}
+	case []float64:
+		for _, item := range value {
+			items = append(items, item)
+		}
+	case []time.Duration:
+		for _, item := range value {
+			items = append(items, item)
+		}
+	case []net.IP:
+		for _, item := range value {
+			items = append(items, item)
+		}
+	case map[string]string:
+		out := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			out[key] = item
+		}
+		return out
+	case map[string]int:
+		out := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			out[key] = item
+		}
+		return out
+	case map[string]int64:
+		out := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			out[key] = item
+		}
+		return out
+	default:
+		return value
+	}
+	if items == nil {
+		return []interface{}{}
+	}
+	return items
+}
+
 // FlagSetConfig can be used to read arguments in the posix flag style
 // into the underlaying Configurable
 type FlagSetConfig struct {
 	Configurable
-	Prefix     string
-	namespaces []string
-	fs         *pflag.FlagSet
+	Prefix string
+	// ChangedOnly only imports the flags that were set on the command line.
+	// The values of the other flags are returned by Defaults, so that when
+	// the config is Used a flag's default doesn't shadow the values from
+	// the environment or config files.
+	ChangedOnly bool
+	namespaces  []string
+	fs          *pflag.FlagSet
+	defaults    map[string]interface{}
 }
 
-// NewFlagSetConfig creates a new FlagSetConfig and returns it as a
-// ReadableConfig
-func NewFlagSetConfig(fs *pflag.FlagSet, prefix string, namespaces ...string) ReadableConfig {
+// Ensure FlagSetConfig implements DefaultsConfig
+var _ DefaultsConfig = (*FlagSetConfig)(nil)
+
+// NewFlagSetConfig creates a new FlagSetConfig and returns it
+func NewFlagSetConfig(fs *pflag.FlagSet, prefix string, namespaces ...string) *FlagSetConfig {
 	cfg := &FlagSetConfig{
 		Configurable: NewMemoryConfig(),
 		Prefix:       prefix,
@@ -28,25 +210,37 @@ func NewFlagSetConfig(fs *pflag.FlagSet, prefix string, namespaces ...string) Re
 	return cfg
 }
 
+// flagKey maps the name of a flag to its key
+func flagKey(name, prefix string, namespaces []string) string {
+	if prefix != "" && strings.HasPrefix(name, prefix) {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	return namespaceKey(name, namespaces)
+}
+
 // Load loads all the variables from argv to the underlaying Configurable.
+// Values keep their native type, slices are expanded into arrays.
 // If a Prefix is provided for FlagSetConfig then keys are imported with the
 // Prefix removed so --test.asd=1 with Prefix 'test.' imports "asd" with
 // value of 1
 func (fsc *FlagSetConfig) Load() (err error) {
+	values := make(map[string]interface{})
+	defaults := make(map[string]interface{})
 	fsc.fs.VisitAll(func(f *pflag.Flag) {
-		name := f.Name
-		if fsc.Prefix != "" && strings.HasPrefix(f.Name, fsc.Prefix) {
-			name = strings.Replace(name, fsc.Prefix, "", 1)
-		}
-		var value interface{}
-		if getter, ok := f.Value.(flag.Getter); ok {
-			value = getter.Get().(string)
+		name := flagKey(f.Name, fsc.Prefix, fsc.namespaces)
+		if fsc.ChangedOnly && !f.Changed {
+			unmarshal(pflagValue(fsc.fs, f), name, defaults)
 		} else {
-			value = f.Value.String()
+			unmarshal(pflagValue(fsc.fs, f), name, values)
 		}
-
-		name = namespaceKey(name, fsc.namespaces)
-		fsc.Set(name, value)
 	})
+	fsc.Reset(values)
+	fsc.defaults = defaults
 	return nil
 }
+
+// Defaults returns the values of the flags that weren't set on the command
+// line when ChangedOnly is set
+func (fsc *FlagSetConfig) Defaults() map[string]interface{} {
+	return fsc.defaults
+}
@@ -1,12 +1,34 @@
 package unicon_test
 
 import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/spf13/pflag"
 	. "github.com/taybin/unicon"
 )
 
+// pointValue is a custom flag value whose Get returns a non-string
+type pointValue struct{ x, y int }
+
+func (p *pointValue) String() string   { return "1,2" }
+func (p *pointValue) Set(string) error { return nil }
+func (p *pointValue) Type() string     { return "point" }
+func (p *pointValue) Get() interface{} { return []int{p.x, p.y} }
+
+func newFlagSet() *pflag.FlagSet {
+	fs := pflag.NewFlagSet("arguments", pflag.ContinueOnError)
+	fs.String("port", "8080", "")
+	fs.String("host", "flag", "")
+	fs.String("name", "flag", "")
+	return fs
+}
+
 var _ = Describe("FlagSetConfig", func() {
 	var (
 		err error
@@ -42,4 +64,108 @@ var _ = Describe("FlagSetConfig", func() {
 		Expect(cfg2.Get("postgres.host")).To(Equal("localhost"))
 		Expect(cfg2.GetInt("postgres.port")).To(Equal(5432))
 	})
+	It("Should preserve the native type of flags", func() {
+		fs := pflag.NewFlagSet("arguments", pflag.ContinueOnError)
+		fs.Int("port", 0, "")
+		fs.Bool("debug", false, "")
+		fs.Duration("timeout", 0, "")
+		fs.IP("bind", nil, "")
+		fs.StringSlice("tags", nil, "")
+		fs.IntSlice("ports", nil, "")
+		fs.StringToString("labels", nil, "")
+		Expect(fs.Parse([]string{
+			"--port=80", "--debug", "--timeout=5s", "--bind=10.0.0.1",
+			"--tags=a,b", "--ports=1,2", "--labels=env=prod",
+		})).To(Succeed())
+		cfg2 := NewFlagSetConfig(fs, "")
+		Expect(cfg2.Load()).To(Succeed())
+		Expect(cfg2.Get("port")).To(Equal(80))
+		Expect(cfg2.Get("debug")).To(Equal(true))
+		Expect(cfg2.Get("timeout")).To(Equal(5 * time.Second))
+		Expect(cfg2.Get("bind")).To(Equal(net.ParseIP("10.0.0.1")))
+		Expect(cfg2.Get("tags[0]")).To(Equal("a"))
+		Expect(cfg2.Get("tags[1]")).To(Equal("b"))
+		Expect(cfg2.Get("tags.length")).To(Equal(2))
+		Expect(cfg2.Get("ports[1]")).To(Equal(2))
+		Expect(cfg2.Get("labels.env")).To(Equal("prod"))
+	})
+	It("Should not panic on getters returning non-strings", func() {
+		fs := pflag.NewFlagSet("arguments", pflag.ContinueOnError)
+		fs.Var(&pointValue{1, 2}, "point", "")
+		cfg2 := NewFlagSetConfig(fs, "")
+		Expect(cfg2.Load()).To(Succeed())
+		Expect(cfg2.Get("point[0]")).To(Equal(1))
+		Expect(cfg2.Get("point[1]")).To(Equal(2))
+	})
+	Describe("ChangedOnly", func() {
+		var (
+			dir  string
+			file string
+			fs   *pflag.FlagSet
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "unicon-flags")
+			Expect(err).ToNot(HaveOccurred())
+			file = filepath.Join(dir, "config.json")
+			Expect(ioutil.WriteFile(file, []byte(`{"port":7070,"host":"file"}`), 0600)).To(Succeed())
+			fs = newFlagSet()
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		hierarchy := func(args []string, env EnvList) *Unicon {
+			fs := newFlagSet()
+			Expect(fs.Parse(args)).To(Succeed())
+			flags := NewFlagSetConfig(fs, "")
+			flags.ChangedOnly = true
+			envCfg := NewEnvConfigFrom(env, "APP_")
+			uni := NewConfig(nil)
+			uni.Use("flags", flags)
+			uni.Use("env", envCfg)
+			uni.Use("file", NewJSONConfig(file))
+			return uni
+		}
+
+		It("Should only import changed flags and supply the others as defaults", func() {
+			Expect(fs.Parse([]string{"--port=9090"})).To(Succeed())
+			flags := NewFlagSetConfig(fs, "")
+			flags.ChangedOnly = true
+			Expect(flags.Load()).To(Succeed())
+			Expect(flags.All()).To(Equal(map[string]interface{}{"port": "9090"}))
+			Expect(flags.Defaults()).To(Equal(map[string]interface{}{"host": "flag", "name": "flag"}))
+		})
+
+		It("Should prefer flags over env over files over flag defaults", func() {
+			uni := hierarchy([]string{"--port=9090"}, EnvList{"APP_PORT=6060", "APP_HOST=env"})
+			Expect(uni.GetInt("port")).To(Equal(9090))
+			Expect(uni.Get("host")).To(Equal("env"))
+			Expect(uni.Get("name")).To(Equal("flag"))
+			Expect(uni.All()).To(Equal(map[string]interface{}{"port": "9090", "HOST": "env", "name": "flag"}))
+
+			uni = hierarchy(nil, EnvList{"APP_PORT=6060"})
+			Expect(uni.GetInt("port")).To(Equal(6060))
+			Expect(uni.Get("host")).To(Equal("file"))
+
+			uni = hierarchy(nil, nil)
+			Expect(uni.GetInt("port")).To(Equal(7070))
+			Expect(uni.GetDefault("port")).To(Equal("8080"))
+		})
+
+		It("Should keep the defaults set with SetDefault over flag defaults", func() {
+			uni := NewConfig(nil)
+			uni.SetDefault("host", "app")
+			flags := NewFlagSetConfig(newFlagSet(), "")
+			flags.ChangedOnly = true
+			uni.Use("flags", flags)
+			Expect(uni.Load()).To(Succeed())
+			Expect(uni.Get("host")).To(Equal("app"))
+			Expect(uni.GetDefault("host")).To(Equal("app"))
+			Expect(uni.Get("name")).To(Equal("flag"))
+			Expect(uni.All()).To(Equal(map[string]interface{}{"host": "app", "port": "8080", "name": "flag"}))
+		})
+	})
 })
@@ -0,0 +1,129 @@
+package unicon
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// ErrReadOnly is returned by Save for configs that are read from a source
+// that can't be written, such as an fs.FS
+var ErrReadOnly = errors.New("unicon: config source is read-only")
+
+// fileSystem reads files from an fs.FS, or from the OS filesystem when fsys
+// is nil.  Paths in an fs.FS are slash separated and unrooted.
+type fileSystem struct {
+	fsys fs.FS
+}
+
+func (f fileSystem) ReadFile(name string) ([]byte, error) {
+	if f.fsys == nil {
+		return os.ReadFile(name)
+	}
+	return fs.ReadFile(f.fsys, name)
+}
+
+func (f fileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	if f.fsys == nil {
+		return os.ReadDir(name)
+	}
+	return fs.ReadDir(f.fsys, name)
+}
+
+// Stat follows symlinks
+func (f fileSystem) Stat(name string) (fs.FileInfo, error) {
+	if f.fsys == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(f.fsys, name)
+}
+
+func (f fileSystem) Open(name string) (fs.File, error) {
+	if f.fsys == nil {
+		return os.Open(name)
+	}
+	return f.fsys.Open(name)
+}
+
+func (f fileSystem) Glob(pattern string) ([]string, error) {
+	if f.fsys == nil {
+		return filepath.Glob(pattern)
+	}
+	return fs.Glob(f.fsys, pattern)
+}
+
+func (f fileSystem) Join(elem ...string) string {
+	if f.fsys == nil {
+		return filepath.Join(elem...)
+	}
+	return path.Join(elem...)
+}
+
+func (f fileSystem) Dir(name string) string {
+	if f.fsys == nil {
+		return filepath.Dir(name)
+	}
+	return path.Dir(name)
+}
+
+func (f fileSystem) IsAbs(name string) bool {
+	if f.fsys == nil {
+		return filepath.IsAbs(name)
+	}
+	// fs.FS paths are always relative to the root of the fs.FS
+	return false
+}
+
+// Abs returns a canonical name for the file, used to detect include cycles
+func (f fileSystem) Abs(name string) (string, error) {
+	if f.fsys == nil {
+		return filepath.Abs(name)
+	}
+	return path.Clean(name), nil
+}
+
+// WriteFile atomically replaces the file at name with data, keeping up to
+// backups previous versions, unless the file is read from an fs.FS
+func (f fileSystem) WriteFile(name string, data []byte, backups int) error {
+	if f.fsys != nil {
+		return fmt.Errorf("%w: %s", ErrReadOnly, name)
+	}
+	return writeFileAtomic(name, data, backups)
+}
+
+// NewFileConfigFS returns a new ReadableConfig backed by the file at path
+// in fsys, such as an embed.FS or os.DirFS.  Save returns ErrReadOnly.
+func NewFileConfigFS(fsys fs.FS, path string, codec ...Codec) *FileConfig {
+	conf := &FileConfig{
+		Configurable: NewMemoryConfig(),
+		Path:         path,
+		FS:           fsys,
+	}
+	if len(codec) > 0 {
+		conf.Codec = codec[0]
+	}
+	LoadConfig(conf)
+	return conf
+}
+
+// LoadDefaultsFS reads the file at path in fsys, typically an embed.FS, and
+// sets its contents as defaults.  The codec is picked by the extension of
+// path unless one is passed explicitly.
+func (uni *Unicon) LoadDefaultsFS(fsys fs.FS, path string, codec ...Codec) error {
+	conf := &FileConfig{
+		Configurable: NewMemoryConfig(),
+		Path:         path,
+		FS:           fsys,
+	}
+	if len(codec) > 0 {
+		conf.Codec = codec[0]
+	}
+	if err := conf.Load(); err != nil {
+		return err
+	}
+	uni.BulkSetDefault(conf.All())
+	return nil
+}
@@ -0,0 +1,76 @@
+package unicon_test
+
+import (
+	"embed"
+	"errors"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+//go:embed config_valid.json
+var embedded embed.FS
+
+var _ = Describe("fs.FS", func() {
+	var fsys fstest.MapFS
+
+	BeforeEach(func() {
+		fsys = fstest.MapFS{
+			"app/config.json":         {Data: []byte(`{"$include":"base/*.json","name":"app"}`)},
+			"app/base/db.json":        {Data: []byte(`{"db":{"host":"localhost"}}`)},
+			"conf.d/10-a.json":        {Data: []byte(`{"a":1}`)},
+			"conf.d/20-b.json":        {Data: []byte(`{"a":2,"b":true}`)},
+			"secrets/..data/token":    {Data: []byte("abc\n")},
+			"secrets/..2020_01/token": {Data: []byte("abc\n")},
+		}
+	})
+
+	It("Should load a FileConfig and its includes from an fs.FS", func() {
+		cfg := NewFileConfigFS(fsys, "app/config.json")
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("name")).To(Equal("app"))
+		Expect(cfg.Get("db.host")).To(Equal("localhost"))
+		Expect(cfg.Source("db.host")).To(Equal("app/base/db.json"))
+	})
+
+	It("Should load a JSONConfig from an embed.FS", func() {
+		cfg := &JSONConfig{Configurable: NewMemoryConfig(), Path: "config_valid.json", FS: embedded}
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("test")).To(Equal("123"))
+	})
+
+	It("Should return ErrReadOnly on Save", func() {
+		cfg := NewFileConfigFS(fsys, "app/config.json")
+		err := cfg.Save()
+		Expect(errors.Is(err, ErrReadOnly)).To(BeTrue())
+
+		jsonCfg := &JSONConfig{Configurable: NewMemoryConfig(), Path: "config_valid.json", FS: embedded}
+		err = jsonCfg.Save()
+		Expect(errors.Is(err, ErrReadOnly)).To(BeTrue())
+	})
+
+	It("Should load a DirConfig from an fs.FS", func() {
+		cfg := &DirConfig{Configurable: NewMemoryConfig(), Path: "conf.d", FS: fsys}
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.GetInt("a")).To(Equal(2))
+		Expect(cfg.Source("b")).To(Equal("conf.d/20-b.json"))
+	})
+
+	It("Should load a KeyPerFileConfig from an fs.FS", func() {
+		cfg := &KeyPerFileConfig{Configurable: NewMemoryConfig(), Path: "secrets", FS: fsys, TrimNewline: true}
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("token")).To(Equal("abc"))
+	})
+
+	It("Should load embedded defaults into a Unicon", func() {
+		uni := NewConfig(nil)
+		Expect(uni.LoadDefaultsFS(embedded, "config_valid.json")).To(Succeed())
+		Expect(uni.GetDefault("test_object.nested_int")).To(Equal(987.0))
+		uni.Set("test", "override")
+		Expect(uni.Get("test")).To(Equal("override"))
+		Expect(uni.GetDefault("test")).To(Equal("123"))
+		Expect(uni.LoadDefaultsFS(embedded, "missing.json")).ToNot(Succeed())
+	})
+})
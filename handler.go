@@ -0,0 +1,270 @@
+package unicon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RedactedValue replaces the values of sensitive keys
+	RedactedValue = "[redacted]"
+	// DefaultMaxWait is the longest a Handler holds a long poll request
+	// when MaxWait is not set
+	DefaultMaxWait = time.Minute
+	// DefaultPollInterval is how often a Handler checks the config for
+	// changes while holding long poll requests when PollInterval is not set
+	DefaultPollInterval = time.Second
+)
+
+var preferWait = regexp.MustCompile(`(?i)(?:^|[,;\s])wait=(\d+)`)
+
+// MatchKeys returns a function reporting whether a key matches one of the
+// path.Match patterns, ignoring case.  It can be used as the Sensitive
+// function of a Handler: MatchKeys("*password", "tls.key").
+func MatchKeys(patterns ...string) func(key string) bool {
+	return func(key string) bool {
+		key = strings.ToLower(key)
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(strings.ToLower(pattern), key); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// sensitivePrefix returns the first of the parents of key, or key itself,
+// that sensitive reports, so that a sensitive "tls" covers "tls.key" too
+func sensitivePrefix(key string, sensitive func(key string) bool) (string, bool) {
+	for _, prefix := range keyPrefixes(key) {
+		if sensitive(prefix) {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+// redact replaces the values of sensitive keys with RedactedValue.  When a
+// parent of a key is sensitive the whole parent is replaced.
+func redact(values map[string]interface{}, sensitive func(key string) bool) map[string]interface{} {
+	out := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		name := key
+		if _, ok := value.(int); ok && strings.HasSuffix(key, ".length") {
+			// the length of an array isn't a secret, and it sizes the array
+			// when the values are nested
+			name = strings.TrimSuffix(key, ".length")
+		}
+		if prefix, ok := sensitivePrefix(name, sensitive); ok {
+			out[prefix] = RedactedValue
+		} else {
+			out[key] = value
+		}
+	}
+	return out
+}
+
+// Handler is an http.Handler serving the values of a Unicon, or of the
+// subtree of a Sub, as a nested JSON document that URLConfig can load.
+// Responses carry a strong ETag and conditional requests are answered with
+// 304 Not Modified.  A conditional request with a "Prefer: wait=N" header
+// is held for up to N seconds until the document changes.  The document is
+// only encoded again when the values of the config changed.
+type Handler struct {
+	Config *Unicon
+	// Sensitive, if set, reports which keys are redacted in addition to the
+	// keys marked by SensitiveConfig layers
+	Sensitive func(key string) bool
+	// Authorize, if set, reports whether r may read the sensitive values.
+	// They are always redacted if Authorize is nil.  The responses are then
+	// marked private, as they depend on what Authorize reads.
+	Authorize func(r *http.Request) bool
+	// MaxWait caps the wait of long poll requests.  Defaults to
+	// DefaultMaxWait.
+	MaxWait time.Duration
+	// PollInterval is how often the config is checked for changes while
+	// long poll requests are held, Changed wakes them up immediately.
+	// Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+
+	mu       sync.Mutex
+	changed  chan struct{}
+	rendered [2]*rendering
+}
+
+// rendering is a document served by a Handler with the values it was
+// encoded from
+type rendering struct {
+	values map[string]interface{}
+	body   []byte
+	etag   string
+}
+
+// NewHandler creates a new Handler serving uni
+func NewHandler(uni *Unicon) *Handler {
+	return &Handler{Config: uni}
+}
+
+// Changed wakes up the long poll requests to check the config for changes,
+// call it after changing the config to notify clients without waiting for
+// the PollInterval
+func (h *Handler) Changed() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.changed != nil {
+		close(h.changed)
+		h.changed = nil
+	}
+}
+
+func (h *Handler) waitChange() <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.changed == nil {
+		h.changed = make(chan struct{})
+	}
+	return h.changed
+}
+
+// render returns the document served to r and its ETag, encoding it again
+// only if the values changed since it was last served
+func (h *Handler) render(r *http.Request) ([]byte, string, error) {
+	values := h.Config.subtree()
+	authorized := 0
+	if h.Authorize != nil && h.Authorize(r) {
+		authorized = 1
+	}
+	h.mu.Lock()
+	cached := h.rendered[authorized]
+	h.mu.Unlock()
+	if cached != nil && reflect.DeepEqual(cached.values, values) {
+		return cached.body, cached.etag, nil
+	}
+
+	served := values
+	if authorized == 0 {
+		served = redact(values, func(key string) bool {
+			return (h.Sensitive != nil && h.Sensitive(key)) || h.Config.Sensitive(key)
+		})
+	}
+	body, err := json.Marshal(nest(served))
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	h.mu.Lock()
+	h.rendered[authorized] = &rendering{values: values, body: body, etag: etag}
+	h.mu.Unlock()
+	return body, etag, nil
+}
+
+// matchETag reports whether the If-None-Match header matches etag
+func matchETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// wait returns how long the request asks to be held
+func (h *Handler) wait(r *http.Request) time.Duration {
+	match := preferWait.FindStringSubmatch(r.Header.Get("Prefer"))
+	if match == nil {
+		return 0
+	}
+	seconds, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	max := h.MaxWait
+	if max <= 0 {
+		max = DefaultMaxWait
+	}
+	if wait := time.Duration(seconds) * time.Second; wait < max {
+		return wait
+	}
+	return max
+}
+
+// ServeHTTP serves the config document to GET and HEAD requests
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, etag, err := h.render(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch != "" && matchETag(ifNoneMatch, etag) {
+		if wait := h.wait(r); wait > 0 {
+			body, etag, err = h.hold(r, wait, etag)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	if h.Authorize != nil {
+		header.Set("Cache-Control", "private, no-cache")
+	} else {
+		header.Set("Cache-Control", "no-cache")
+	}
+	if ifNoneMatch != "" && matchETag(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method == http.MethodGet {
+		w.Write(body)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// hold waits up to wait for the document served to r to no longer match
+// etag and returns the latest document
+func (h *Handler) hold(r *http.Request, wait time.Duration, etag string) ([]byte, string, error) {
+	interval := h.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil, etag, nil
+		case <-timeout.C:
+			return nil, etag, nil
+		case <-ticker.C:
+		case <-h.waitChange():
+		}
+		body, latest, err := h.render(r)
+		if err != nil || latest != etag {
+			return body, latest, err
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package unicon_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+// secretConfig marks all its values as sensitive
+type secretConfig struct {
+	*MemoryConfig
+}
+
+func (secretConfig) Sensitive(key string) bool { return true }
+
+var _ = Describe("Handler", func() {
+	var (
+		uni     *Unicon
+		handler *Handler
+	)
+
+	BeforeEach(func() {
+		uni = NewConfig(nil)
+		uni.Set("db.host", "localhost")
+		uni.Set("db.password", "hunter2")
+		uni.Set("db.replicas", []interface{}{"a", "b"})
+		uni.SetDefault("port", 8080)
+		handler = NewHandler(uni)
+	})
+
+	get := func(h http.Handler, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	decodeBody := func(rec *httptest.ResponseRecorder) map[string]interface{} {
+		var out map[string]interface{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &out)).To(Succeed())
+		return out
+	}
+
+	It("Should serve the config as nested json", func() {
+		rec := get(handler, nil)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(decodeBody(rec)).To(Equal(map[string]interface{}{
+			"db": map[string]interface{}{
+				"host":     "localhost",
+				"password": "hunter2",
+				"replicas": []interface{}{"a", "b"},
+			},
+			"port": float64(8080),
+		}))
+	})
+
+	It("Should serve the subtree of a Sub", func() {
+		rec := get(NewHandler(uni.Sub("db")), nil)
+		Expect(decodeBody(rec)).To(HaveKeyWithValue("host", "localhost"))
+		Expect(decodeBody(rec)).ToNot(HaveKey("port"))
+	})
+
+	It("Should be consumable by URLConfig", func() {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		url := NewURLConfig(server.URL)
+		Expect(url.Load()).To(Succeed())
+		Expect(url.Get("db.host")).To(Equal("localhost"))
+		Expect(url.Get("db.replicas[1]")).To(Equal("b"))
+		Expect(url.GetInt("port")).To(Equal(8080))
+		Expect(url.ETag()).ToNot(BeEmpty())
+	})
+
+	It("Should answer conditional requests with strong etags", func() {
+		etag := get(handler, nil).Header().Get("ETag")
+		Expect(etag).To(MatchRegexp(`^"[0-9a-f]+"$`))
+		rec := get(handler, http.Header{"If-None-Match": {etag}})
+		Expect(rec.Code).To(Equal(http.StatusNotModified))
+		Expect(rec.Body.Len()).To(BeZero())
+
+		uni.Set("db.host", "example.com")
+		rec = get(handler, http.Header{"If-None-Match": {etag}})
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("ETag")).ToNot(Equal(etag))
+	})
+
+	It("Should redact sensitive keys unless authorised", func() {
+		uni.Use("secrets", secretConfig{NewMemoryConfig()})
+		uni.Use("secrets").Set("api.token", "t0ken")
+		handler.Sensitive = MatchKeys("*.password", "db.replicas")
+		handler.Authorize = func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer admin"
+		}
+
+		db := decodeBody(get(handler, nil))["db"].(map[string]interface{})
+		Expect(db["password"]).To(Equal(RedactedValue))
+		Expect(db["replicas"]).To(Equal(RedactedValue))
+		Expect(db["host"]).To(Equal("localhost"))
+		Expect(decodeBody(get(handler, nil))["api"]).To(HaveKeyWithValue("token", RedactedValue))
+
+		rec := get(handler, http.Header{"Authorization": {"Bearer admin"}})
+		Expect(rec.Header().Get("Cache-Control")).To(Equal("private, no-cache"))
+		body := decodeBody(rec)
+		Expect(body["db"]).To(HaveKeyWithValue("password", "hunter2"))
+		Expect(body["api"]).To(HaveKeyWithValue("token", "t0ken"))
+		Expect(decodeBody(get(handler, nil))["db"]).To(HaveKeyWithValue("password", RedactedValue))
+	})
+
+	It("Should encode the document again only when the config changes", func() {
+		renders := 0
+		handler.Sensitive = func(key string) bool {
+			if key == "port" {
+				renders++
+			}
+			return false
+		}
+		first := get(handler, nil)
+		Expect(first.Header().Get("Cache-Control")).To(Equal("no-cache"))
+		Expect(first.Header().Get("Vary")).To(BeEmpty())
+		Expect(get(handler, nil).Body.Bytes()).To(Equal(first.Body.Bytes()))
+		Expect(renders).To(Equal(1))
+
+		uni.Set("db.host", "example.com")
+		second := get(handler, nil)
+		Expect(renders).To(Equal(2))
+		Expect(second.Header().Get("ETag")).ToNot(Equal(first.Header().Get("ETag")))
+		Expect(decodeBody(second)["db"]).To(HaveKeyWithValue("host", "example.com"))
+	})
+
+	It("Should reject other methods", func() {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	Describe("Long polling", func() {
+		var etag string
+
+		BeforeEach(func() {
+			etag = get(handler, nil).Header().Get("ETag")
+		})
+
+		It("Should hold the request until the config changes", func() {
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(50 * time.Millisecond)
+				uni.Set("db.host", "example.com")
+				handler.Changed()
+			}()
+			start := time.Now()
+			rec := get(handler, http.Header{"If-None-Match": {etag}, "Prefer": {"wait=10"}})
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(decodeBody(rec)["db"]).To(HaveKeyWithValue("host", "example.com"))
+		})
+
+		It("Should notice changes by polling", func() {
+			handler.PollInterval = 10 * time.Millisecond
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				uni.Set("db.host", "example.com")
+			}()
+			rec := get(handler, http.Header{"If-None-Match": {etag}, "Prefer": {"wait=10"}})
+			Expect(rec.Code).To(Equal(http.StatusOK))
+		})
+
+		It("Should answer not modified after the wait", func() {
+			handler.MaxWait = 50 * time.Millisecond
+			start := time.Now()
+			rec := get(handler, http.Header{"If-None-Match": {etag}, "Prefer": {"wait=10"}})
+			Expect(rec.Code).To(Equal(http.StatusNotModified))
+			Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		})
+	})
+})
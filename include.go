@@ -0,0 +1,162 @@
+package unicon
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// IncludeKey is the top level key of the directive that pulls other files
+// into a config file, its value is a path or a list of paths and glob
+// patterns relative to the including file:
+//
+//	{"$include": ["base.json", "db/*.json"], "db": {"host": "override"}}
+//
+// Included files are merged in order beneath the including file's own
+// values.
+const IncludeKey = "$include"
+
+// loadedFile is the merged result of reading a config file and everything
+// it includes
+type loadedFile struct {
+	fs     fileSystem
+	path   string
+	values map[string]interface{}
+	// sources maps the lowercased keys to the file that supplied them
+	sources map[string]string
+	// include is the raw directive of the top level file, kept for Save
+	include interface{}
+}
+
+// loadFile reads the file at path with codec and resolves its includes
+func loadFile(fsys fileSystem, path string, codec Codec) (*loadedFile, error) {
+	lf := &loadedFile{
+		fs:      fsys,
+		path:    path,
+		values:  make(map[string]interface{}),
+		sources: make(map[string]string),
+	}
+	include, err := lf.load(path, codec, nil)
+	if err != nil {
+		return nil, err
+	}
+	lf.include = include
+	return lf, nil
+}
+
+func (lf *loadedFile) load(path string, codec Codec, stack []string) (interface{}, error) {
+	abs, err := lf.fs.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, seen := range stack {
+		if seen == abs {
+			cycle := append(append([]string{}, stack[i:]...), abs)
+			return nil, fmt.Errorf("unicon: include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	stack = append(stack, abs)
+
+	data, err := lf.fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	out, err := codec.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("unicon: %s: %v", path, err)
+	}
+
+	include, ok := out[IncludeKey]
+	delete(out, IncludeKey)
+	if ok {
+		includes, err := lf.includePaths(path, include)
+		if err != nil {
+			return nil, err
+		}
+		for _, included := range includes {
+			includedCodec, err := CodecForPath(included)
+			if err != nil {
+				includedCodec = codec
+			}
+			if _, err := lf.load(included, includedCodec, stack); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	values := make(map[string]interface{})
+	unmarshalMap(out, "", values)
+	for _, key := range mergeFlat(lf.values, values) {
+		delete(lf.sources, strings.ToLower(key))
+	}
+	for key := range values {
+		lf.sources[strings.ToLower(key)] = path
+	}
+	return include, nil
+}
+
+// includePaths expands the include directive of the file at path into the
+// list of files to load
+func (lf *loadedFile) includePaths(path string, include interface{}) ([]string, error) {
+	var patterns []string
+	switch include := include.(type) {
+	case string:
+		patterns = append(patterns, include)
+	case []interface{}:
+		for _, pattern := range include {
+			pattern, ok := pattern.(string)
+			if !ok {
+				return nil, fmt.Errorf("unicon: %s: %s must be a list of strings", path, IncludeKey)
+			}
+			patterns = append(patterns, pattern)
+		}
+	default:
+		return nil, fmt.Errorf("unicon: %s: %s must be a string or a list of strings", path, IncludeKey)
+	}
+
+	var paths []string
+	for _, pattern := range patterns {
+		if !lf.fs.IsAbs(pattern) {
+			pattern = lf.fs.Join(lf.fs.Dir(path), pattern)
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			paths = append(paths, pattern)
+			continue
+		}
+		matches, err := lf.fs.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("unicon: %s: %v", path, err)
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// Source returns the file that supplied key
+func (lf *loadedFile) Source(key string) string {
+	if lf == nil {
+		return ""
+	}
+	return lf.sources[strings.ToLower(key)]
+}
+
+// prune prepares data for saving back to the top level file.  Keys that
+// still hold the value loaded from an included file are left to that file
+// and the include directive is restored.
+func (lf *loadedFile) prune(data map[string]interface{}) map[string]interface{} {
+	if lf == nil || lf.include == nil {
+		return data
+	}
+	pruned := make(map[string]interface{})
+	for key, value := range data {
+		source := lf.Source(key)
+		if source != "" && source != lf.path && reflect.DeepEqual(value, lf.values[key]) {
+			continue
+		}
+		pruned[key] = value
+	}
+	pruned[IncludeKey] = lf.include
+	return pruned
+}
@@ -0,0 +1,100 @@
+package unicon_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+var _ = Describe("$include", func() {
+	var dir string
+
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "unicon-include")
+		Expect(err).ToNot(HaveOccurred())
+		write("base.json", `{"name":"base","db":{"host":"base","port":5432}}`)
+		write("db/10-host.json", `{"db":{"host":"db10"}}`)
+		write("db/20-user.json", `{"db":{"user":"db20"}}`)
+		write("main.json", `{"$include":["base.json","db/*.json"],"name":"main"}`)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("Should merge included files beneath the file's own values", func() {
+		cfg := NewJSONConfig(filepath.Join(dir, "main.json"))
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("name")).To(Equal("main"))
+		Expect(cfg.Get("db.host")).To(Equal("db10"))
+		Expect(cfg.Get("db.user")).To(Equal("db20"))
+		Expect(cfg.GetInt("db.port")).To(Equal(5432))
+		Expect(cfg.Get(IncludeKey)).To(BeNil())
+	})
+
+	It("Should replace included arrays with the file's own", func() {
+		write("base.json", `{"servers":["a","b","c"]}`)
+		write("main.json", `{"$include":"base.json","servers":["d"]}`)
+		cfg := NewJSONConfig(filepath.Join(dir, "main.json"))
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("servers[0]")).To(Equal("d"))
+		Expect(cfg.Get("servers[2]")).To(BeNil())
+		Expect(cfg.Get("servers.length")).To(Equal(1))
+	})
+
+	It("Should report the file that supplied each key", func() {
+		cfg := NewFileConfig(filepath.Join(dir, "main.json"))
+		Expect(cfg.Source("name")).To(Equal(filepath.Join(dir, "main.json")))
+		Expect(cfg.Source("db.host")).To(Equal(filepath.Join(dir, "db/10-host.json")))
+		Expect(cfg.Source("db.port")).To(Equal(filepath.Join(dir, "base.json")))
+	})
+
+	It("Should resolve includes relative to the including file", func() {
+		write("db/20-user.json", `{"$include":"../base.json","db":{"user":"db20"}}`)
+		cfg := NewDirConfig(filepath.Join(dir, "db"))
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("name")).To(Equal("base"))
+		Expect(cfg.Source("name")).To(Equal(filepath.Join(dir, "base.json")))
+	})
+
+	It("Should detect include cycles", func() {
+		write("a.json", `{"$include":"b.json"}`)
+		write("b.json", `{"$include":"a.json"}`)
+		cfg := NewJSONConfig(filepath.Join(dir, "a.json"))
+		err := cfg.Load()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("include cycle"))
+	})
+
+	It("Should error on a missing include", func() {
+		write("main.json", `{"$include":"missing.json"}`)
+		cfg := NewJSONConfig(filepath.Join(dir, "main.json"))
+		Expect(cfg.Load()).ToNot(Succeed())
+	})
+
+	It("Should keep the directive and leave included keys out on Save", func() {
+		cfg := NewJSONConfig(filepath.Join(dir, "main.json"))
+		cfg.Set("db.port", 6543)
+		Expect(cfg.Save()).To(Succeed())
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "main.json"))
+		Expect(err).ToNot(HaveOccurred())
+		saved := make(map[string]interface{})
+		Expect(json.Unmarshal(data, &saved)).To(Succeed())
+		Expect(saved).To(HaveKey(IncludeKey))
+		Expect(saved).To(HaveKey("name"))
+		Expect(saved["db"]).To(Equal(map[string]interface{}{"port": 6543.0}))
+	})
+})
@@ -1,27 +1,33 @@
 package unicon
 
 import (
-	"encoding/json"
-	"io/ioutil"
+	"io/fs"
+	"sync"
 )
 
 // JSONConfig is the json configurable
 type JSONConfig struct {
 	Configurable
 	Path string
+	// FS to read Path from instead of the OS filesystem, configs read from
+	// an FS can't be saved
+	FS fs.FS
+	// Indent, if set, is used to indent each level of the saved json
+	Indent string
+	// Backups is the number of previous versions Save keeps as Path.1,
+	// Path.2 and so on
+	Backups int
+	// mu guards loaded, which Load replaces along with the values
+	mu      sync.Mutex
+	loaded  *loadedFile
+	changes changes
 }
 
-func unmarshalJSON(bytes []byte) (map[string]interface{}, error) {
-	out := make(map[string]interface{})
-	if err := json.Unmarshal(bytes, &out); err != nil {
-		return nil, err
-	}
-
-	output := make(map[string]interface{})
-	unmarshalMap(out, "", output)
-
-	return output, nil
-}
+// Ensure JSONConfig implements SourcedConfig and PendingConfig
+var (
+	_ SourcedConfig = (*JSONConfig)(nil)
+	_ PendingConfig = (*JSONConfig)(nil)
+)
 
 // NewJSONConfig returns a new WritableConfig backed by a json file at path.
 // The file does not need to exist, if it does not exist the first Save call
@@ -31,38 +37,90 @@ func NewJSONConfig(path string, cfg ...Configurable) *JSONConfig {
 		cfg = append(cfg, NewMemoryConfig())
 	}
 	LoadConfig(cfg[0])
-	conf := &JSONConfig{cfg[0], path}
+	conf := &JSONConfig{Configurable: cfg[0], Path: path}
 	LoadConfig(conf)
 	return conf
 }
 
-// Load attempts to load the json configuration at JSONConfig.Path
-// and Set them into the underlaying Configurable
+// Load attempts to load the json configuration at JSONConfig.Path, along
+// with the files it includes, and Set them into the underlaying Configurable
+// Changes that haven't been saved yet are kept on top of the loaded values
+// and stay pending.
 func (jc *JSONConfig) Load() (err error) {
-	var data []byte
-	if data, err = ioutil.ReadFile(jc.Path); err != nil {
-		return
-	}
-	out, err := unmarshalJSON(data)
+	loaded, err := loadFile(fileSystem{jc.FS}, jc.Path, JSONCodec{})
 	if err != nil {
 		return
 	}
 
-	jc.Configurable.Reset(out)
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	jc.changes.reload(jc.Configurable, loaded.values)
+	jc.loaded = loaded
 	return
 }
 
+// Source returns the file that supplied key, which is an included file
+// rather than JSONConfig.Path if the key came from an $include directive
+func (jc *JSONConfig) Source(key string) string {
+	return jc.loadedFile().Source(key)
+}
+
+// loadedFile returns the file as of the last Load
+func (jc *JSONConfig) loadedFile() *loadedFile {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	return jc.loaded
+}
+
 // Save attempts to save the configuration from the underlaying Configurable
-// to json file at JSONConfig.Path
+// to json file at JSONConfig.Path.  The file is replaced atomically, see
+// Backups to keep previous versions.  The flattened keys are nested back into
+// objects and arrays, with object keys in sorted order, so that loading the
+// saved file gives the same configuration.  Keys that still hold the value
+// loaded from an included file are not copied into JSONConfig.Path.
 func (jc *JSONConfig) Save() (err error) {
-	b, err := json.Marshal(jc.Configurable.All())
+	snapshot := jc.changes.snapshot()
+	codec := JSONCodec{Indent: jc.Indent}
+	b, err := codec.Encode(nest(jc.loadedFile().prune(jc.Configurable.All())))
 	if err != nil {
 		return err
 	}
 
-	if err := ioutil.WriteFile(jc.Path, b, 0600); err != nil {
+	fsys := fileSystem{jc.FS}
+	if err := fsys.WriteFile(jc.Path, b, jc.Backups); err != nil {
 		return err
 	}
-
+	jc.changes.clean(snapshot)
 	return nil
 }
+
+// Set a key to value, the change is pending until the next Save
+func (jc *JSONConfig) Set(key string, value interface{}) {
+	jc.Configurable.Set(key, value)
+	jc.changes.touch(key)
+}
+
+// BulkSet overwrites items with the provided map, the changes are pending
+// until the next Save
+func (jc *JSONConfig) BulkSet(items map[string]interface{}) {
+	jc.Configurable.BulkSet(items)
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	jc.changes.touch(keys...)
+}
+
+// Reset the data to the provided data, the change is pending until the next
+// Save
+func (jc *JSONConfig) Reset(datas ...map[string]interface{}) {
+	jc.Configurable.Reset(datas...)
+	jc.changes.touchAll()
+}
+
+// Pending reports whether there are changes that haven't been saved.  It
+// is also true until the file was loaded or saved once, so that Save
+// creates a missing file.
+func (jc *JSONConfig) Pending() bool {
+	return jc.changes.pending()
+}
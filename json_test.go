@@ -1,6 +1,10 @@
 package unicon_test
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	. "github.com/taybin/unicon"
@@ -89,6 +93,91 @@ var _ = Describe("JSONConfig", func() {
 		})
 	})
 
+	Describe("Saving", func() {
+		var path string
+
+		readJSON := func(path string) map[string]interface{} {
+			data, err := ioutil.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			out := make(map[string]interface{})
+			Expect(json.Unmarshal(data, &out)).To(Succeed())
+			return out
+		}
+
+		BeforeEach(func() {
+			path = "./config_test_save.json"
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("Should write a semantically identical file after Load", func() {
+			jsonCfg := cfg.(*JSONConfig)
+			jsonCfg.Path = path
+			Expect(jsonCfg.Save()).To(Succeed())
+			Expect(readJSON(path)).To(Equal(readJSON("./config_valid.json")))
+
+			cfg2 := NewJSONConfig(path)
+			Expect(cfg2.Load()).To(Succeed())
+			Expect(cfg2.All()).To(Equal(cfg.All()))
+		})
+
+		It("Should rebuild nested objects and arrays", func() {
+			cfg = NewJSONConfig(path)
+			cfg.Set("Server.Port", 80)
+			cfg.Set("servers", []interface{}{"a", "b"})
+			cfg.Set("empty", []interface{}{})
+			cfg.Set("grid", []interface{}{[]interface{}{1, 2}})
+			Expect(cfg.Save()).To(Succeed())
+			Expect(readJSON(path)).To(Equal(map[string]interface{}{
+				"Server":  map[string]interface{}{"Port": 80.0},
+				"servers": []interface{}{"a", "b"},
+				"empty":   []interface{}{},
+				"grid":    []interface{}{[]interface{}{1.0, 2.0}},
+			}))
+		})
+
+		It("Should keep conflicting keys flattened", func() {
+			cfg = NewJSONConfig(path)
+			cfg.Set("a.b", 2)
+			cfg.Set("a.b.c", 3)
+			Expect(cfg.Save()).To(Succeed())
+			Expect(readJSON(path)).To(Equal(map[string]interface{}{
+				"a": map[string]interface{}{"b": 2.0, "b.c": 3.0},
+			}))
+			cfg2 := NewJSONConfig(path)
+			Expect(cfg2.GetInt("a.b")).To(Equal(2))
+			Expect(cfg2.GetInt("a.b.c")).To(Equal(3))
+		})
+
+		It("Should keep indexes far past the end of an array flattened", func() {
+			cfg = NewJSONConfig(path)
+			cfg.Set("a[0]", "x")
+			cfg.Set("a[99999999999]", "y")
+			cfg.Set("b[9223372036854775807]", "z")
+			cfg.Set("c.length", 99999999999)
+			Expect(cfg.Save()).To(Succeed())
+			Expect(readJSON(path)).To(Equal(map[string]interface{}{
+				"a":                      []interface{}{"x"},
+				"a[99999999999]":         "y",
+				"b[9223372036854775807]": "z",
+			}))
+			cfg2 := NewJSONConfig(path)
+			Expect(cfg2.Load()).To(Succeed())
+			Expect(cfg2.Get("a[99999999999]")).To(Equal("y"))
+		})
+
+		It("Should indent when asked to", func() {
+			cfg = &JSONConfig{Configurable: NewMemoryConfig(), Path: path, Indent: "  "}
+			cfg.Set("a.b", 1)
+			Expect(cfg.Save()).To(Succeed())
+			data, err := ioutil.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("{\n  \"a\": {\n    \"b\": 1\n  }\n}"))
+		})
+	})
+
 	Describe("Config conversion", func() {
 		It("Should be possible ro construct new JSON config from a gonfig hierarchy", func() {
 			cfg := NewConfig(nil)
@@ -0,0 +1,155 @@
+package unicon
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxFileSize is the per file size limit used by KeyPerFileConfig
+// when MaxFileSize is not set, it matches the Kubernetes limit for a
+// Secret or ConfigMap.
+const DefaultMaxFileSize = 1 << 20
+
+// kubernetesDataDir is the symlink Kubernetes swaps atomically to publish
+// a new version of a mounted Secret or ConfigMap
+const kubernetesDataDir = "..data"
+
+// KeyPerFileConfig is a configurable backed by a directory with one file
+// per key, as used by Docker secrets and Kubernetes Secret and ConfigMap
+// volumes.  /run/secrets/db_password is imported as "db_password".
+type KeyPerFileConfig struct {
+	Configurable
+	Path string
+	// Separator, if set, is replaced by "." in file names so that with
+	// Separator "__" the file db__password is imported as "db.password"
+	Separator string
+	// TrimNewline removes trailing newlines from the file contents
+	TrimNewline bool
+	// MaxFileSize is the size limit in bytes of a single file, Load fails
+	// if a file is larger.  Defaults to DefaultMaxFileSize.
+	MaxFileSize int64
+	// FS to read Path from instead of the OS filesystem
+	FS fs.FS
+	// mu guards sources, which Load replaces along with the values
+	mu      sync.Mutex
+	sources map[string]string
+}
+
+// Ensure KeyPerFileConfig implements SourcedConfig
+var _ SourcedConfig = (*KeyPerFileConfig)(nil)
+
+// NewKeyPerFileConfig returns a new ReadableConfig backed by the files in
+// the directory at path
+func NewKeyPerFileConfig(path string) *KeyPerFileConfig {
+	conf := &KeyPerFileConfig{
+		Configurable: NewMemoryConfig(),
+		Path:         path,
+	}
+	LoadConfig(conf)
+	return conf
+}
+
+// dir returns the directory to read keys from.  When Kubernetes manages the
+// directory the ..data symlink is resolved once so that a single Load never
+// mixes files from before and after an update.
+func (kc *KeyPerFileConfig) dir() (string, error) {
+	fsys := fileSystem{kc.FS}
+	data := fsys.Join(kc.Path, kubernetesDataDir)
+	if kc.FS != nil {
+		// an fs.FS can't resolve symlinks, read through ..data instead
+		if _, err := fsys.Stat(data); err != nil {
+			return kc.Path, nil
+		}
+		return data, nil
+	}
+	if _, err := os.Lstat(data); err != nil {
+		return kc.Path, nil
+	}
+	return filepath.EvalSymlinks(data)
+}
+
+func (kc *KeyPerFileConfig) readFile(path string) (string, error) {
+	limit := kc.MaxFileSize
+	if limit <= 0 {
+		limit = DefaultMaxFileSize
+	}
+	file, err := fileSystem{kc.FS}.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > limit {
+		return "", fmt.Errorf("unicon: %s is larger than %d bytes", path, limit)
+	}
+	value := string(data)
+	if kc.TrimNewline {
+		value = strings.TrimRight(value, "\r\n")
+	}
+	return value, nil
+}
+
+// Load reads every file in KeyPerFileConfig.Path and replaces the contents
+// of the underlaying Configurable with them.  Hidden files, including the
+// ..data style entries maintained by Kubernetes, and directories are
+// skipped.
+func (kc *KeyPerFileConfig) Load() error {
+	dir, err := kc.dir()
+	if err != nil {
+		return err
+	}
+	fsys := fileSystem{kc.FS}
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]interface{})
+	sources := make(map[string]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := fsys.Join(dir, name)
+		// follow symlinks, ReadDir only reports the link itself
+		info, err := fsys.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			continue
+		}
+		value, err := kc.readFile(path)
+		if err != nil {
+			return err
+		}
+		key := name
+		if kc.Separator != "" {
+			key = strings.Replace(key, kc.Separator, ".", -1)
+		}
+		values[key] = value
+		sources[strings.ToLower(key)] = fsys.Join(kc.Path, name)
+	}
+
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	kc.Configurable.Reset(values)
+	kc.sources = sources
+	return nil
+}
+
+// Source returns the path of the file that supplied key
+func (kc *KeyPerFileConfig) Source(key string) string {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	return kc.sources[strings.ToLower(key)]
+}
@@ -0,0 +1,83 @@
+package unicon_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+var _ = Describe("KeyPerFileConfig", func() {
+	var dir string
+
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "unicon-secrets")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("Should import each file as a key", func() {
+		write("db_password", "hunter2\n")
+		write(".hidden", "nope")
+		write("subdir/key", "nope")
+		cfg := NewKeyPerFileConfig(dir)
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.All()).To(HaveLen(1))
+		Expect(cfg.Get("db_password")).To(Equal("hunter2\n"))
+		Expect(cfg.Source("db_password")).To(Equal(filepath.Join(dir, "db_password")))
+	})
+
+	It("Should map separators to dots and trim newlines", func() {
+		write("db__password", "hunter2\r\n")
+		cfg := &KeyPerFileConfig{
+			Configurable: NewMemoryConfig(),
+			Path:         dir,
+			Separator:    "__",
+			TrimNewline:  true,
+		}
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("db.password")).To(Equal("hunter2"))
+	})
+
+	It("Should enforce the size limit", func() {
+		write("big", strings.Repeat("x", 11))
+		cfg := &KeyPerFileConfig{
+			Configurable: NewMemoryConfig(),
+			Path:         dir,
+			MaxFileSize:  10,
+		}
+		Expect(cfg.Load()).ToNot(Succeed())
+		cfg.MaxFileSize = 11
+		Expect(cfg.Load()).To(Succeed())
+	})
+
+	It("Should follow the Kubernetes ..data symlink swap", func() {
+		write("..2020_01/token", "v1")
+		Expect(os.Symlink("..2020_01", filepath.Join(dir, "..data"))).To(Succeed())
+		Expect(os.Symlink("..data/token", filepath.Join(dir, "token"))).To(Succeed())
+		cfg := NewKeyPerFileConfig(dir)
+		Expect(cfg.Get("token")).To(Equal("v1"))
+		Expect(cfg.All()).To(HaveLen(1))
+
+		// atomically swap ..data as the kubelet does
+		write("..2020_02/token", "v2")
+		Expect(os.Symlink("..2020_02", filepath.Join(dir, "..data_tmp"))).To(Succeed())
+		Expect(os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data"))).To(Succeed())
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("token")).To(Equal("v2"))
+	})
+})
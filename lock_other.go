@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package unicon
+
+import (
+	"os"
+)
+
+// lockDir is a no-op on platforms without flock, concurrent writers from
+// several processes are not serialized there
+func lockDir(dir string) (func(), error) {
+	return func() {}, nil
+}
+
+// chown is a no-op on the platforms without flock, file ownership is not
+// kept there
+func chown(path string, info os.FileInfo) {}
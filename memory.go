@@ -2,6 +2,7 @@ package unicon
 
 import (
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cast"
@@ -10,6 +11,7 @@ import (
 // MemoryConfig is a simple abstraction to map[]interface{} for in process memory backed configuration
 // only implements Configurable use JsonConfig to save/load if needed
 type MemoryConfig struct {
+	mu     sync.RWMutex
 	data   map[string]interface{}
 	casing map[string]string
 }
@@ -29,21 +31,27 @@ func (mem *MemoryConfig) init() {
 	mem.casing = make(map[string]string)
 }
 
-// Reset if no arguments are provided Reset() re-creates the underlaying map
+// Reset if no arguments are provided Reset() re-creates the underlaying map.
+// The new data replaces the old at once, readers never see a mix of both.
 func (mem *MemoryConfig) Reset(datas ...map[string]interface{}) {
-	mem.data = make(map[string]interface{})
+	data := make(map[string]interface{})
+	casing := make(map[string]string)
 	if len(datas) >= 1 {
 		for key, value := range datas[0] {
-			mem.Set(key, value)
+			casing[strings.ToLower(key)] = key
+			data[strings.ToLower(key)] = value
 		}
 	}
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	mem.data = data
+	mem.casing = casing
 }
 
 // Get key from map
 func (mem *MemoryConfig) Get(key string) interface{} {
-	if mem.data == nil {
-		mem.init()
-	}
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
 	return mem.data[strings.ToLower(key)]
 }
 
@@ -84,9 +92,8 @@ func (mem *MemoryConfig) GetDuration(key string) time.Duration {
 
 // All returns all keys
 func (mem *MemoryConfig) All() map[string]interface{} {
-	if mem.data == nil {
-		mem.init()
-	}
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
 	allMap := make(map[string]interface{})
 	for key, value := range mem.data {
 		allMap[mem.casing[key]] = value
@@ -96,6 +103,8 @@ func (mem *MemoryConfig) All() map[string]interface{} {
 
 // Set a key to value
 func (mem *MemoryConfig) Set(key string, value interface{}) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
 	if mem.data == nil {
 		mem.init()
 	}
@@ -1,10 +1,6 @@
 package unicon
 
 import (
-	"flag"
-	"os"
-	"strings"
-
 	"github.com/spf13/pflag"
 )
 
@@ -12,43 +8,79 @@ import (
 // into the underlaying Configurable
 type PflagConfig struct {
 	Configurable
-	Prefix     string
-	namespaces []string
+	// FlagSet holds the flags to import, pflag.CommandLine if nil.  It must
+	// be parsed before Load, such as with pflag.Parse().
+	FlagSet *pflag.FlagSet
+	Prefix  string
+	// Decoder, if set, decodes the values of string flags into typed values
+	Decoder *ValueDecoder
+	// ChangedOnly only imports the flags that were set on the command line,
+	// the values of the other flags are returned by Defaults
+	ChangedOnly bool
+	namespaces  []string
+	defaults    map[string]interface{}
+}
+
+// Ensure PflagConfig implements DefaultsConfig
+var _ DefaultsConfig = (*PflagConfig)(nil)
+
+// NewPflagConfig creates a new PflagConfig reading pflag.CommandLine and
+// returns it
+func NewPflagConfig(prefix string, namespaces ...string) *PflagConfig {
+	return NewPflagConfigFrom(nil, prefix, namespaces...)
 }
 
-// NewPflagConfig creates a new PflagConfig and returns it as a ReadableConfig
-func NewPflagConfig(prefix string, namespaces ...string) ReadableConfig {
+// NewPflagConfigFrom creates a new PflagConfig reading the flags of fs
+// instead of pflag.CommandLine and returns it
+func NewPflagConfigFrom(fs *pflag.FlagSet, prefix string, namespaces ...string) *PflagConfig {
 	cfg := &PflagConfig{
 		Configurable: NewMemoryConfig(),
+		FlagSet:      fs,
 		Prefix:       prefix,
 		namespaces:   nsSlice(namespaces),
 	}
 	return cfg
 }
 
-// Load loads all the variables from argv to the underlaying Configurable.
+func (pc *PflagConfig) flagSet() *pflag.FlagSet {
+	if pc.FlagSet == nil {
+		return pflag.CommandLine
+	}
+	return pc.FlagSet
+}
+
+// Load loads all the flags of the FlagSet to the underlaying Configurable.
+// Values keep their native type, slices are expanded into arrays.
 // If a Prefix is provided for PflagConfig then keys are imported with the
 // Prefix removed so --test.asd=1 with Prefix 'test.' imports "asd" with
 // value of 1
 func (pc *PflagConfig) Load() (err error) {
-	flagset := pflag.NewFlagSet("arguments", pflag.ContinueOnError)
-	flagset.Parse(os.Args)
-
+	flagset := pc.flagSet()
+	values := make(map[string]interface{})
+	defaults := make(map[string]interface{})
 	flagset.VisitAll(func(f *pflag.Flag) {
-		name := f.Name
-		if pc.Prefix != "" && strings.HasPrefix(f.Name, pc.Prefix) {
-			name = strings.Replace(name, pc.Prefix, "", 1)
+		name := flagKey(f.Name, pc.Prefix, pc.namespaces)
+		target := values
+		if pc.ChangedOnly && !f.Changed {
+			target = defaults
 		}
-
-		var value interface{}
-		if getter, ok := f.Value.(flag.Getter); ok {
-			value = getter.Get().(string)
-		} else {
-			value = f.Value.String()
+		value := pflagValue(flagset, f)
+		if str, ok := value.(string); !ok {
+			unmarshal(value, name, target)
+		} else if err == nil {
+			err = decodeValue(pc.Decoder, name, str, target)
 		}
-
-		name = namespaceKey(name, pc.namespaces)
-		pc.Set(name, value)
 	})
+	if err != nil {
+		return err
+	}
+	pc.Reset(values)
+	pc.defaults = defaults
 	return nil
 }
+
+// Defaults returns the values of the flags that weren't set on the command
+// line when ChangedOnly is set
+func (pc *PflagConfig) Defaults() map[string]interface{} {
+	return pc.defaults
+}
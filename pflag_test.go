@@ -1,6 +1,8 @@
 package unicon_test
 
 import (
+	"github.com/spf13/pflag"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	. "github.com/taybin/unicon"
@@ -10,11 +12,18 @@ var _ = Describe("PflagConfig", func() {
 	var (
 		err error
 		cfg ReadableConfig
+		fs  *pflag.FlagSet
 	)
 	BeforeEach(func() {
 		cfg = NewPflagConfig("test")
 		err = cfg.Load()
 		Expect(err).ToNot(HaveOccurred())
+
+		fs = pflag.NewFlagSet("test", pflag.ContinueOnError)
+		fs.String("test.name", "app", "")
+		fs.Int("port", 80, "")
+		fs.String("servers", "", "")
+		fs.String("db-host", "localhost", "")
 	})
 	It("Should load variables from commandline", func() {
 		Expect(len(cfg.All()) >= 0).To(BeTrue())
@@ -22,4 +31,35 @@ var _ = Describe("PflagConfig", func() {
 		cfg2.Load()
 		Expect(len(cfg2.All()) >= len(cfg.All())).To(BeTrue())
 	})
+	It("Should load the flags of a flag set", func() {
+		Expect(fs.Parse([]string{"--port=8080", "--test.name=api"})).To(Succeed())
+		pc := NewPflagConfigFrom(fs, "test.", "db")
+		Expect(pc.Load()).To(Succeed())
+		Expect(pc.Get("name")).To(Equal("api"))
+		Expect(pc.Get("port")).To(Equal(8080))
+		Expect(pc.Get("db.host")).To(Equal("localhost"))
+		Expect(pc.Defaults()).To(BeEmpty())
+	})
+	It("Should only import changed flags with ChangedOnly", func() {
+		Expect(fs.Parse([]string{"--port=8080"})).To(Succeed())
+		pc := NewPflagConfigFrom(fs, "")
+		pc.ChangedOnly = true
+		Expect(pc.Load()).To(Succeed())
+		Expect(pc.All()).To(Equal(map[string]interface{}{"port": 8080}))
+		Expect(pc.Defaults()).To(HaveKeyWithValue("test.name", "app"))
+		Expect(pc.Defaults()).To(HaveKeyWithValue("db-host", "localhost"))
+	})
+	It("Should decode string flags with the Decoder", func() {
+		Expect(fs.Parse([]string{`--servers=["a","b"]`})).To(Succeed())
+		pc := NewPflagConfigFrom(fs, "")
+		pc.Decoder = &ValueDecoder{}
+		Expect(pc.Load()).To(Succeed())
+		Expect(pc.Get("servers[1]")).To(Equal("b"))
+		Expect(pc.Get("servers.length")).To(Equal(2))
+		Expect(pc.Get("port")).To(Equal(80))
+
+		fs.Set("servers", "{")
+		pc.Decoder = &ValueDecoder{Keys: map[string]DecodeFunc{"servers": DecodeJSON}}
+		Expect(pc.Load()).ToNot(Succeed())
+	})
 })
@@ -0,0 +1,183 @@
+package unicon
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultRefreshJitter is the Jitter of the Refreshers created by
+	// NewRefresher
+	DefaultRefreshJitter = 0.1
+	// DefaultMaxRefreshBackoff is the longest delay between the loads of a
+	// failing config when MaxBackoff is not set
+	DefaultMaxRefreshBackoff = 5 * time.Minute
+	// MinLongPollDelay is the shortest delay before the next long poll when
+	// the source answered without waiting for a change
+	MinLongPollDelay = 100 * time.Millisecond
+	// MinRefreshInterval is the Interval used when Interval is zero or
+	// negative, so that a Refresher never loads in a busy loop
+	MinRefreshInterval = time.Second
+)
+
+// ContextConfig is a ReadableConfig whose Load can be abandoned through a
+// context, such as URLConfig
+type ContextConfig interface {
+	ReadableConfig
+	// LoadContext loads the configuration until ctx is done
+	LoadContext(ctx context.Context) error
+}
+
+// Refresher reloads a config periodically, and before its values expire
+// for a config with an Expires method such as VaultConfig.  The values of
+// a config are replaced with a single Reset by Load, so readers see either
+// the old or the new values of the whole config, never a mix.
+type Refresher struct {
+	Config ReadableConfig
+	// Interval between the loads, MinRefreshInterval if it isn't positive
+	Interval time.Duration
+	// Jitter randomizes every delay by up to this fraction of it, so that
+	// many processes don't load a shared source in lockstep
+	Jitter float64
+	// MaxBackoff caps the delay between the loads of a failing config,
+	// which doubles after every failure.  Defaults to
+	// DefaultMaxRefreshBackoff, or Interval if that is longer.
+	MaxBackoff time.Duration
+	// LongPoll, if set and Config is a URLConfig whose server sent an ETag
+	// or a ConsulConfig, holds every request for up to LongPoll until the
+	// source changes, instead of loading it every Interval.  A source that
+	// answers well before LongPoll without a change, such as a server that
+	// ignores the Prefer header, is polled every Interval, and no more
+	// often than MinLongPollDelay.
+	LongPoll time.Duration
+	// OnError, if set, is called with the errors of failed loads
+	OnError func(error)
+}
+
+// NewRefresher creates a new Refresher loading config every interval
+func NewRefresher(config ReadableConfig, interval time.Duration) *Refresher {
+	return &Refresher{
+		Config:   config,
+		Interval: interval,
+		Jitter:   DefaultRefreshJitter,
+	}
+}
+
+// Run reloads the config until ctx is done, abandoning a Load in progress
+// for a ContextConfig.  The config is expected to be loaded already, so Run
+// waits before the first load, unless it is long polling.
+func (r *Refresher) Run(ctx context.Context) {
+	failures := 0
+	early := false
+	for {
+		var delay time.Duration
+		if failures > 0 || !r.longPolling() {
+			delay = r.delay(failures)
+		} else if early {
+			// the source didn't hold the request
+			delay = r.delay(0)
+			if delay < MinLongPollDelay {
+				delay = MinLongPollDelay
+			}
+		}
+		if ec, ok := r.Config.(expiringConfig); ok && failures == 0 {
+			// reload expiring values in time
+			if expires := ec.Expires(); !expires.IsZero() && time.Until(expires) < delay {
+				delay = time.Until(expires)
+			}
+		}
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		polling, version, started := r.longPolling(), r.version(), time.Now()
+		err := r.load(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		early = polling && time.Since(started) < r.LongPoll/2 && r.version() == version
+		if err == nil {
+			failures = 0
+			continue
+		}
+		failures++
+		if r.OnError != nil {
+			r.OnError(err)
+		}
+	}
+}
+
+// expiringConfig is a config whose values expire, such as VaultConfig
+type expiringConfig interface {
+	// Expires returns when the values must be loaded again, the zero time
+	// if they don't expire
+	Expires() time.Time
+}
+
+// longPoller is a config whose source can hold a request until it changes
+type longPoller interface {
+	LongPoll(ctx context.Context, wait time.Duration) error
+	// polling reports whether the config knows the version of its values,
+	// so that LongPoll waits for a change
+	polling() bool
+	// version returns the version of the loaded values
+	version() string
+}
+
+// longPolling reports whether the next load is a long poll
+func (r *Refresher) longPolling() bool {
+	lp, ok := r.Config.(longPoller)
+	return ok && r.LongPoll > 0 && lp.polling()
+}
+
+// version returns the version of the values of a long polled config
+func (r *Refresher) version() string {
+	if lp, ok := r.Config.(longPoller); ok {
+		return lp.version()
+	}
+	return ""
+}
+
+func (r *Refresher) load(ctx context.Context) error {
+	if r.longPolling() {
+		return r.Config.(longPoller).LongPoll(ctx, r.LongPoll)
+	}
+	if cc, ok := r.Config.(ContextConfig); ok {
+		return cc.LoadContext(ctx)
+	}
+	return r.Config.Load()
+}
+
+// delay returns the jittered delay before the next load after failures
+// consecutive failed loads
+func (r *Refresher) delay(failures int) time.Duration {
+	delay := r.Interval
+	if delay <= 0 {
+		delay = MinRefreshInterval
+	}
+	if failures > 0 {
+		max := r.MaxBackoff
+		if max <= 0 {
+			max = DefaultMaxRefreshBackoff
+		}
+		if max < delay {
+			max = delay
+		}
+		for i := 0; i < failures && delay > 0 && delay < max; i++ {
+			delay *= 2
+		}
+		if delay > max {
+			delay = max
+		}
+	}
+	if r.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * r.Jitter * float64(delay))
+	}
+	return delay
+}
@@ -0,0 +1,215 @@
+package unicon_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+// loadingConfig records the time of every Load and fails while failing is
+// set
+type loadingConfig struct {
+	*MemoryConfig
+	mu      sync.Mutex
+	loads   []time.Time
+	failing bool
+}
+
+func (lc *loadingConfig) Load() error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.loads = append(lc.loads, time.Now())
+	if lc.failing {
+		return errors.New("unavailable")
+	}
+	lc.Reset(map[string]interface{}{"loads": len(lc.loads)})
+	return nil
+}
+
+func (lc *loadingConfig) Count() int {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return len(lc.loads)
+}
+
+func (lc *loadingConfig) Loads() []time.Time {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return append([]time.Time(nil), lc.loads...)
+}
+
+var _ = Describe("Refresher", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		done   chan struct{}
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan struct{})
+	})
+
+	AfterEach(func() {
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	run := func(r *Refresher) {
+		go func() {
+			defer close(done)
+			r.Run(ctx)
+		}()
+	}
+
+	It("Should reload the config every interval", func() {
+		cfg := &loadingConfig{MemoryConfig: NewMemoryConfig()}
+		run(NewRefresher(cfg, 10*time.Millisecond))
+		Eventually(cfg.Count).Should(BeNumerically(">=", 3))
+		Expect(cfg.GetInt("loads")).To(BeNumerically(">=", 3))
+	})
+
+	It("Should stop when the context is done", func() {
+		cfg := &loadingConfig{MemoryConfig: NewMemoryConfig()}
+		run(NewRefresher(cfg, time.Hour))
+		cancel()
+		Eventually(done).Should(BeClosed())
+		Expect(cfg.Loads()).To(BeEmpty())
+	})
+
+	It("Should not load in a busy loop without an interval", func() {
+		cfg := &loadingConfig{MemoryConfig: NewMemoryConfig()}
+		run(NewRefresher(cfg, 0))
+		Consistently(cfg.Count, 200*time.Millisecond).Should(BeZero())
+	})
+
+	It("Should report the sources of the values while it loads", func() {
+		dir, err := ioutil.TempDir("", "unicon-refresh")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(ioutil.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"a":1}`), 0600)).To(Succeed())
+		// the key per file config has a key named after the file
+		keys := map[SourcedConfig]string{
+			NewJSONConfig(filepath.Join(dir, "a.json")): "a",
+			NewFileConfig(filepath.Join(dir, "a.json")): "a",
+			NewDirConfig(dir):        "a",
+			NewKeyPerFileConfig(dir): "a.json",
+		}
+		ctx, stop := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		for cfg := range keys {
+			wg.Add(1)
+			go func(cfg ReadableConfig) {
+				defer wg.Done()
+				NewRefresher(cfg, time.Millisecond).Run(ctx)
+			}(cfg.(ReadableConfig))
+		}
+		for i := 0; i < 100; i++ {
+			for cfg, key := range keys {
+				Expect(cfg.Source(key)).ToNot(BeEmpty())
+			}
+			time.Sleep(time.Millisecond)
+		}
+		stop()
+		wg.Wait()
+		close(done)
+	})
+
+	It("Should back off exponentially on failures", func() {
+		cfg := &loadingConfig{MemoryConfig: NewMemoryConfig(), failing: true}
+		var errs int32
+		r := NewRefresher(cfg, 10*time.Millisecond)
+		r.Jitter = 0
+		r.MaxBackoff = 40 * time.Millisecond
+		r.OnError = func(error) { atomic.AddInt32(&errs, 1) }
+		run(r)
+		Eventually(cfg.Count).Should(BeNumerically(">=", 4))
+		loads := cfg.Loads()
+		Expect(loads[1].Sub(loads[0])).To(BeNumerically(">=", 20*time.Millisecond))
+		Expect(loads[2].Sub(loads[1])).To(BeNumerically(">=", 40*time.Millisecond))
+		Expect(loads[3].Sub(loads[2])).To(BeNumerically(">=", 40*time.Millisecond))
+		Expect(atomic.LoadInt32(&errs)).To(BeNumerically(">=", 3))
+	})
+
+	It("Should long poll URLConfigs", func() {
+		var (
+			mu      sync.Mutex
+			version = 1
+			changed = make(chan struct{})
+			waits   = make(chan string, 10)
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			etag, wait := fmt.Sprintf(`"%d"`, version), changed
+			mu.Unlock()
+			if r.Header.Get("If-None-Match") == etag {
+				waits <- r.Header.Get("Prefer")
+				select {
+				case <-wait:
+				case <-r.Context().Done():
+					return
+				}
+				mu.Lock()
+				etag = fmt.Sprintf(`"%d"`, version)
+				mu.Unlock()
+			}
+			w.Header().Set("ETag", etag)
+			fmt.Fprintf(w, `{"version":%s}`, etag)
+		}))
+		defer server.Close()
+		defer cancel()
+
+		url := NewURLConfig(server.URL)
+		Expect(url.Load()).To(Succeed())
+		r := NewRefresher(url, time.Hour)
+		r.LongPoll = 30 * time.Second
+		run(r)
+
+		Eventually(waits).Should(Receive(Equal("wait=30")))
+		mu.Lock()
+		version = 2
+		close(changed)
+		changed = make(chan struct{})
+		mu.Unlock()
+		Eventually(func() int { return url.GetInt("version") }).Should(Equal(2))
+		Eventually(waits).Should(Receive())
+	})
+
+	It("Should wait between long polls a server doesn't hold", func() {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			if r.Header.Get("If-None-Match") == `"1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"1"`)
+			fmt.Fprint(w, `{"version":1}`)
+		}))
+		defer server.Close()
+		defer cancel()
+
+		url := NewURLConfig(server.URL)
+		Expect(url.Load()).To(Succeed())
+		r := NewRefresher(url, 50*time.Millisecond)
+		r.Jitter = 0
+		r.LongPoll = 30 * time.Second
+		run(r)
+
+		time.Sleep(500 * time.Millisecond)
+		Expect(atomic.LoadInt32(&requests)).To(BeNumerically("<=", 7))
+		Expect(atomic.LoadInt32(&requests)).To(BeNumerically(">=", 3))
+	})
+})
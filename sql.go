@@ -0,0 +1,442 @@
+package unicon
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of the values stored by SQLConfig in the TypeColumn
+const (
+	SQLString   = "string"
+	SQLInt      = "int"
+	SQLFloat    = "float"
+	SQLBool     = "bool"
+	SQLDuration = "duration"
+	SQLTime     = "time"
+	SQLJSON     = "json"
+)
+
+// DollarPlaceholder returns the numbered placeholders used by PostgreSQL,
+// $1 for the first parameter
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// OnConflictUpsert is the Upsert of SQLConfig for PostgreSQL and SQLite, an
+// INSERT ... ON CONFLICT DO UPDATE on the key column, the first of columns
+func OnConflictUpsert(table string, columns, placeholders []string) string {
+	updates := make([]string, 0, len(columns)-1)
+	for _, column := range columns[1:] {
+		updates = append(updates, column+" = excluded."+column)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s", table,
+		strings.Join(columns, ", "), strings.Join(placeholders, ", "), columns[0], strings.Join(updates, ", "))
+}
+
+// OnDuplicateKeyUpsert is the Upsert of SQLConfig for MySQL, an INSERT ...
+// ON DUPLICATE KEY UPDATE
+func OnDuplicateKeyUpsert(table string, columns, placeholders []string) string {
+	updates := make([]string, 0, len(columns)-1)
+	for _, column := range columns[1:] {
+		updates = append(updates, column+" = VALUES("+column+")")
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s", table,
+		strings.Join(columns, ", "), strings.Join(placeholders, ", "), strings.Join(updates, ", "))
+}
+
+// SQLConfig is a configurable backed by a table of a database/sql database
+// with a row per key.  The value column holds the text form of the value
+// and the type column its type, one of the SQL type constants, so the
+// values keep their type.  The table and column names are put in the
+// queries as they are and must not come from untrusted input, a name that
+// is a reserved word must be given quoted, such as "`key`" for MySQL.
+type SQLConfig struct {
+	Configurable
+	DB *sql.DB
+	// Table holds the config, "config" if empty
+	Table string
+	// KeyColumn, ValueColumn and TypeColumn are the names of the columns,
+	// "config_key", "config_value" and "config_type" if empty
+	KeyColumn   string
+	ValueColumn string
+	TypeColumn  string
+	// UpdatedColumn, if set, is a timestamp column Save sets to the time of
+	// the change.  Load then only reads the table again if the number of
+	// rows or the latest timestamp changed, so it is cheap to poll with a
+	// Refresher.
+	UpdatedColumn string
+	// Placeholder returns the placeholder of the nth parameter of a query,
+	// "?" if nil.  Use DollarPlaceholder for PostgreSQL.
+	Placeholder func(n int) string
+	// Upsert, if set, returns the statement inserting a row into table, or
+	// updating the row of its key, the first of columns, if there is one.
+	// The key column must then be unique.  Use OnConflictUpsert for
+	// PostgreSQL and SQLite and OnDuplicateKeyUpsert for MySQL.
+	Upsert func(table string, columns, placeholders []string) string
+
+	mu      sync.Mutex
+	saved   map[string]sqlRow
+	version string
+}
+
+// sqlRow is a key with its value as last loaded or saved and the key of
+// the row it is stored in, which differs for the keys of a json row
+type sqlRow struct {
+	key   string
+	value interface{}
+	row   string
+}
+
+// Ensure SQLConfig implements PendingConfig
+var _ PendingConfig = (*SQLConfig)(nil)
+
+// NewSQLConfig returns a new WritableConfig backed by table in db
+func NewSQLConfig(db *sql.DB, table string) *SQLConfig {
+	return &SQLConfig{
+		Configurable: NewMemoryConfig(),
+		DB:           db,
+		Table:        table,
+	}
+}
+
+func (sc *SQLConfig) table() string {
+	return orDefault(sc.Table, "config")
+}
+
+func (sc *SQLConfig) columns() (string, string, string) {
+	return orDefault(sc.KeyColumn, "config_key"), orDefault(sc.ValueColumn, "config_value"), orDefault(sc.TypeColumn, "config_type")
+}
+
+func (sc *SQLConfig) placeholder(n int) string {
+	if sc.Placeholder != nil {
+		return sc.Placeholder(n)
+	}
+	return "?"
+}
+
+// encodeSQLValue returns the type and the text form of value
+func encodeSQLValue(value interface{}) (string, string, error) {
+	switch value := value.(type) {
+	case string:
+		return SQLString, value, nil
+	case bool:
+		return SQLBool, strconv.FormatBool(value), nil
+	case time.Duration:
+		return SQLDuration, value.String(), nil
+	case time.Time:
+		return SQLTime, value.Format(time.RFC3339Nano), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return SQLInt, fmt.Sprint(value), nil
+	case float32:
+		return SQLFloat, strconv.FormatFloat(float64(value), 'g', -1, 32), nil
+	case float64:
+		return SQLFloat, strconv.FormatFloat(value, 'g', -1, 64), nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", "", err
+	}
+	return SQLJSON, string(data), nil
+}
+
+// decodeSQLValue decodes the text form of a value of type typ and flattens
+// it into out
+func decodeSQLValue(key, typ, text string, out map[string]interface{}) error {
+	var value interface{}
+	var err error
+	switch typ {
+	case SQLInt:
+		if value, err = strconv.Atoi(text); err != nil {
+			value, err = strconv.ParseInt(text, 10, 64)
+		}
+	case SQLFloat:
+		value, err = strconv.ParseFloat(text, 64)
+	case SQLBool:
+		value, err = strconv.ParseBool(text)
+	case SQLDuration:
+		value, err = time.ParseDuration(text)
+	case SQLTime:
+		value, err = time.Parse(time.RFC3339Nano, text)
+	case SQLJSON:
+		err = json.Unmarshal([]byte(text), &value)
+	default:
+		value = text
+	}
+	if err != nil {
+		return fmt.Errorf("unicon: decoding %s: %v", key, err)
+	}
+	unmarshal(value, key, out)
+	return nil
+}
+
+// Load reads all the rows of the table
+func (sc *SQLConfig) Load() error {
+	return sc.LoadContext(context.Background())
+}
+
+// LoadContext reads all the rows of the table, the queries are abandoned
+// when ctx is done.  With an UpdatedColumn the rows are only read if the
+// table changed since the last Load.  Changes that haven't been saved yet
+// are kept on top of the rows and stay pending.
+func (sc *SQLConfig) LoadContext(ctx context.Context) error {
+	version, err := sc.tableVersion(ctx)
+	if err != nil {
+		return err
+	}
+	sc.mu.Lock()
+	unchanged := version != "" && version == sc.version
+	sc.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	keyColumn, valueColumn, typeColumn := sc.columns()
+	rows, err := sc.DB.QueryContext(ctx, fmt.Sprintf("SELECT %s, %s, %s FROM %s",
+		keyColumn, valueColumn, typeColumn, sc.table()))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	values := make(map[string]interface{})
+	snapshot := make(map[string]sqlRow)
+	for rows.Next() {
+		var key string
+		var value, typ sql.NullString
+		if err := rows.Scan(&key, &value, &typ); err != nil {
+			return err
+		}
+		decoded := make(map[string]interface{})
+		if err := decodeSQLValue(key, typ.String, value.String, decoded); err != nil {
+			return err
+		}
+		for name, value := range decoded {
+			values[name] = value
+			snapshot[strings.ToLower(name)] = sqlRow{name, value, key}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	changed, removed := sc.pendingChanges()
+	for key := range values {
+		if removed[strings.ToLower(key)] {
+			delete(values, key)
+		}
+	}
+	mergeFlat(values, changed)
+	sc.Reset(values)
+
+	sc.mu.Lock()
+	sc.saved = snapshot
+	sc.version = version
+	sc.mu.Unlock()
+	return nil
+}
+
+// tableVersion returns the number of rows and the latest UpdatedColumn of
+// the table, "" without an UpdatedColumn
+func (sc *SQLConfig) tableVersion(ctx context.Context) (string, error) {
+	if sc.UpdatedColumn == "" {
+		return "", nil
+	}
+	var count int64
+	var latest interface{}
+	err := sc.DB.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*), MAX(%s) FROM %s",
+		sc.UpdatedColumn, sc.table())).Scan(&count, &latest)
+	if err != nil {
+		return "", err
+	}
+	if b, ok := latest.([]byte); ok {
+		latest = string(b)
+	}
+	return fmt.Sprintf("%d %v", count, latest), nil
+}
+
+// diff returns the keys that changed since the last Load or Save, the
+// rows to delete and the rows the keys are stored in after saving.  When a
+// key loaded from a json row changes, the json row is replaced by a row per
+// key.
+func (sc *SQLConfig) diff(values map[string]interface{}) (changed, removed []string, saved map[string]sqlRow) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	split := make(map[string]bool)
+	changes := make(map[string]bool)
+	deletes := make(map[string]bool)
+	present := make(map[string]bool, len(values))
+	for key, value := range values {
+		present[strings.ToLower(key)] = true
+		old, ok := sc.saved[strings.ToLower(key)]
+		switch {
+		case value == nil:
+			if ok {
+				deletes[old.row] = true
+			}
+		case !ok:
+			changes[key] = true
+		case old.key != key || !reflect.DeepEqual(old.value, value):
+			changes[key] = true
+			deletes[old.row] = true
+		default:
+			continue
+		}
+		if ok && old.row != old.key {
+			split[old.row] = true
+		}
+	}
+	for lower, old := range sc.saved {
+		if !present[lower] {
+			deletes[old.row] = true
+			if old.row != old.key {
+				split[old.row] = true
+			}
+		}
+	}
+
+	saved = make(map[string]sqlRow, len(values))
+	for key, value := range values {
+		if value == nil {
+			continue
+		}
+		row := key
+		if old, ok := sc.saved[strings.ToLower(key)]; ok && !changes[key] {
+			if split[old.row] {
+				changes[key] = true
+			} else {
+				row = old.row
+			}
+		}
+		saved[strings.ToLower(key)] = sqlRow{key, value, row}
+	}
+	for key := range changes {
+		changed = append(changed, key)
+		// the row of a changed key is replaced
+		delete(deletes, key)
+	}
+	for row := range deletes {
+		removed = append(removed, row)
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return changed, removed, saved
+}
+
+// pendingChanges returns the values of the keys changed since the last Load
+// or Save, and the lowercased keys that were removed
+func (sc *SQLConfig) pendingChanges() (changed map[string]interface{}, removed map[string]bool) {
+	values := sc.All()
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	changed = make(map[string]interface{})
+	removed = make(map[string]bool)
+	for key, value := range values {
+		old, ok := sc.saved[strings.ToLower(key)]
+		if !ok || old.key != key || !reflect.DeepEqual(old.value, value) {
+			changed[key] = value
+		}
+	}
+	for lower := range sc.saved {
+		removed[lower] = true
+	}
+	for key := range values {
+		delete(removed, strings.ToLower(key))
+	}
+	return changed, removed
+}
+
+// Pending reports whether there are changes that haven't been saved
+func (sc *SQLConfig) Pending() bool {
+	changed, removed, _ := sc.diff(sc.All())
+	return len(changed) > 0 || len(removed) > 0
+}
+
+// Save writes the keys changed since the last Load or Save
+func (sc *SQLConfig) Save() error {
+	return sc.SaveContext(context.Background())
+}
+
+// SaveContext writes the keys changed since the last Load or Save in a
+// single transaction, keys set to nil or removed by Reset are deleted.  A
+// changed key is written with the Upsert statement, or without one by
+// deleting its row and inserting it again, which works the same with every
+// database.  When two processes save the same key at once, the later one
+// wins with Upsert.  Without it the later insert can fail on the unique
+// key, its transaction is then rolled back and the changes stay pending
+// for the next Save.  Values other than strings, numbers, bools,
+// durations and times are stored as json.
+func (sc *SQLConfig) SaveContext(ctx context.Context) error {
+	values := sc.All()
+	changed, removed, saved := sc.diff(values)
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	keyColumn, valueColumn, typeColumn := sc.columns()
+	del := fmt.Sprintf("DELETE FROM %s WHERE %s = %s", sc.table(), keyColumn, sc.placeholder(1))
+	columns := []string{keyColumn, valueColumn, typeColumn}
+	if sc.UpdatedColumn != "" {
+		columns = append(columns, sc.UpdatedColumn)
+	}
+	placeholders := make([]string, len(columns))
+	for i := range placeholders {
+		placeholders[i] = sc.placeholder(i + 1)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", sc.table(),
+		strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	if sc.Upsert != nil {
+		insert = sc.Upsert(sc.table(), columns, placeholders)
+	}
+
+	tx, err := sc.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	err = func() error {
+		for _, key := range removed {
+			if _, err := tx.ExecContext(ctx, del, key); err != nil {
+				return err
+			}
+		}
+		for _, key := range changed {
+			typ, text, err := encodeSQLValue(values[key])
+			if err != nil {
+				return fmt.Errorf("unicon: encoding %s: %v", key, err)
+			}
+			if sc.Upsert == nil {
+				if _, err := tx.ExecContext(ctx, del, key); err != nil {
+					return err
+				}
+			}
+			args := []interface{}{key, text, typ}
+			if sc.UpdatedColumn != "" {
+				args = append(args, now)
+			}
+			if _, err := tx.ExecContext(ctx, insert, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	sc.mu.Lock()
+	sc.saved = saved
+	// read the table again on the next Load to pick the new timestamps
+	sc.version = ""
+	sc.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,448 @@
+package unicon_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+// fakeRow is a row of the table of fakeDB
+type fakeRow struct {
+	value   interface{}
+	typ     string
+	updated time.Time
+}
+
+// fakeDB is a database/sql driver holding a single config table in memory.
+// It understands the queries of SQLConfig only.
+type fakeDB struct {
+	mu      sync.Mutex
+	rows    map[string]fakeRow
+	queries []string
+	begins  int
+	commits int
+	// failKey makes the insert of that key fail
+	failKey string
+}
+
+func newFakeDB(rows map[string]fakeRow) *fakeDB {
+	return &fakeDB{rows: rows}
+}
+
+func (db *fakeDB) Put(key string, value interface{}, typ string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.rows[key] = fakeRow{value, typ, time.Now()}
+}
+
+// Row returns the row of key, the zero row if there is none
+func (db *fakeDB) Row(key string) fakeRow {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.rows[key]
+}
+
+func (db *fakeDB) Queries() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	queries := db.queries
+	db.queries = nil
+	return queries
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	db     *fakeDB
+	backup map[string]fakeRow
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.begins++
+	c.backup = make(map[string]fakeRow, len(c.db.rows))
+	for key, row := range c.db.rows {
+		c.backup[key] = row
+	}
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.commits++
+	c.backup = nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.rows = c.backup
+	c.backup = nil
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.queries = append(db.queries, s.query)
+	key := args[0].(string)
+	switch {
+	case strings.HasPrefix(s.query, "DELETE FROM "):
+		if _, ok := db.rows[key]; !ok {
+			return driver.RowsAffected(0), nil
+		}
+		delete(db.rows, key)
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(s.query, "INSERT INTO "):
+		if key == db.failKey {
+			return nil, errors.New("insert failed")
+		}
+		upsert := strings.Contains(s.query, " ON CONFLICT ") || strings.Contains(s.query, " ON DUPLICATE KEY ")
+		if _, ok := db.rows[key]; ok && !upsert {
+			return nil, errors.New("duplicate key")
+		}
+		row := fakeRow{value: args[1], typ: args[2].(string)}
+		if len(args) > 3 {
+			row.updated = args[3].(time.Time)
+		}
+		db.rows[key] = row
+		return driver.RowsAffected(1), nil
+	}
+	return nil, errors.New("unexpected exec: " + s.query)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	db := s.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.queries = append(db.queries, s.query)
+	if strings.HasPrefix(s.query, "SELECT COUNT(*), MAX(") {
+		var latest interface{}
+		for _, row := range db.rows {
+			if latest == nil || row.updated.After(latest.(time.Time)) {
+				latest = row.updated
+			}
+		}
+		return &fakeRows{columns: 2, values: [][]driver.Value{{int64(len(db.rows)), latest}}}, nil
+	}
+	if !strings.HasPrefix(s.query, "SELECT ") {
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+	keys := make([]string, 0, len(db.rows))
+	for key := range db.rows {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	rows := &fakeRows{columns: 3}
+	for _, key := range keys {
+		var typ interface{}
+		if db.rows[key].typ != "" {
+			typ = db.rows[key].typ
+		}
+		rows.values = append(rows.values, []driver.Value{key, db.rows[key].value, typ})
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns int
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return make([]string, r.columns) }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var _ = Describe("SQLConfig", func() {
+	var (
+		fake *fakeDB
+		db   *sql.DB
+		cfg  *SQLConfig
+	)
+
+	BeforeEach(func() {
+		fake = newFakeDB(map[string]fakeRow{
+			"name":           {value: "app", typ: "string"},
+			"port":           {value: "8080", typ: "int"},
+			"debug":          {value: "true", typ: "bool"},
+			"timeout":        {value: "1m30s", typ: "duration"},
+			"ratio":          {value: "0.5", typ: "float"},
+			"servers":        {value: `["a","b"]`, typ: "json"},
+			"untyped":        {value: "text"},
+			"nothing":        {typ: "string"},
+			"database.host":  {value: "localhost", typ: "string"},
+			"database.ports": {value: `{"main":5432}`, typ: "json"},
+		})
+		db = sql.OpenDB(fake)
+		cfg = NewSQLConfig(db, "settings")
+		Expect(cfg.Load()).To(Succeed())
+		fake.Queries()
+	})
+
+	AfterEach(func() {
+		db.Close()
+	})
+
+	It("Should load the rows with their types", func() {
+		Expect(cfg.Get("name")).To(Equal("app"))
+		Expect(cfg.Get("port")).To(Equal(8080))
+		Expect(cfg.Get("debug")).To(Equal(true))
+		Expect(cfg.Get("timeout")).To(Equal(90 * time.Second))
+		Expect(cfg.Get("ratio")).To(Equal(0.5))
+		Expect(cfg.Get("untyped")).To(Equal("text"))
+		Expect(cfg.Get("nothing")).To(Equal(""))
+		Expect(cfg.Get("servers[1]")).To(Equal("b"))
+		Expect(cfg.Get("servers.length")).To(Equal(2))
+		Expect(cfg.Get("database.host")).To(Equal("localhost"))
+		Expect(cfg.Get("database.ports.main")).To(Equal(float64(5432)))
+		Expect(cfg.Pending()).To(BeFalse())
+	})
+
+	It("Should query the table and columns", func() {
+		cfg = NewSQLConfig(db, "")
+		Expect(cfg.Load()).To(Succeed())
+		Expect(fake.Queries()).To(Equal([]string{"SELECT config_key, config_value, config_type FROM config"}))
+
+		cfg = NewSQLConfig(db, "settings")
+		cfg.KeyColumn, cfg.ValueColumn, cfg.TypeColumn = "k", "v", "t"
+		Expect(cfg.Load()).To(Succeed())
+		Expect(fake.Queries()).To(Equal([]string{"SELECT k, v, t FROM settings"}))
+	})
+
+	It("Should fail on a value that doesn't match its type", func() {
+		fake.Put("port", "http", "int")
+		err := cfg.Load()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("decoding port"))
+		Expect(cfg.Get("port")).To(Equal(8080))
+	})
+
+	It("Should save only the changed keys in a single transaction", func() {
+		cfg.Set("port", 9090)
+		cfg.Set("name", "app")
+		cfg.Set("limits.max", int64(10))
+		cfg.Set("started", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+		cfg.Set("labels", map[string]string{"env": "prod"})
+		Expect(cfg.Pending()).To(BeTrue())
+		Expect(cfg.Save()).To(Succeed())
+		Expect(cfg.Pending()).To(BeFalse())
+
+		Expect(fake.begins).To(Equal(1))
+		Expect(fake.commits).To(Equal(1))
+		Expect(fake.Queries()).To(HaveLen(8))
+		Expect(fake.Row("port")).To(Equal(fakeRow{value: "9090", typ: "int"}))
+		Expect(fake.Row("limits.max")).To(Equal(fakeRow{value: "10", typ: "int"}))
+		Expect(fake.Row("started")).To(Equal(fakeRow{value: "2020-01-02T03:04:05Z", typ: "time"}))
+		Expect(fake.Row("labels")).To(Equal(fakeRow{value: `{"env":"prod"}`, typ: "json"}))
+
+		Expect(cfg.Save()).To(Succeed())
+		Expect(fake.begins).To(Equal(1))
+
+		reloaded := NewSQLConfig(db, "settings")
+		Expect(reloaded.Load()).To(Succeed())
+		Expect(reloaded.All()).To(Equal(map[string]interface{}{
+			"name":                "app",
+			"port":                9090,
+			"debug":               true,
+			"timeout":             90 * time.Second,
+			"ratio":               0.5,
+			"servers[0]":          "a",
+			"servers[1]":          "b",
+			"servers.length":      2,
+			"untyped":             "text",
+			"nothing":             "",
+			"database.host":       "localhost",
+			"database.ports.main": float64(5432),
+			"limits.max":          10,
+			"started":             time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			"labels.env":          "prod",
+		}))
+	})
+
+	It("Should delete the keys set to nil or removed", func() {
+		cfg.Set("debug", nil)
+		values := cfg.All()
+		delete(values, "untyped")
+		cfg.Reset(values)
+		Expect(cfg.Save()).To(Succeed())
+		Expect(fake.Row("debug")).To(BeZero())
+		Expect(fake.Row("untyped")).To(BeZero())
+		Expect(cfg.Pending()).To(BeFalse())
+	})
+
+	It("Should keep the changes that weren't saved when it loads", func() {
+		cfg.Set("port", 9090)
+		cfg.Set("debug", nil)
+		values := cfg.All()
+		delete(values, "untyped")
+		cfg.Reset(values)
+		fake.Put("name", "renamed", "string")
+		fake.Put("port", "7070", "int")
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("name")).To(Equal("renamed"))
+		Expect(cfg.Get("port")).To(Equal(9090))
+		Expect(cfg.Get("debug")).To(BeNil())
+		Expect(cfg.Get("untyped")).To(BeNil())
+		Expect(cfg.Pending()).To(BeTrue())
+
+		Expect(cfg.Save()).To(Succeed())
+		Expect(fake.Row("port")).To(Equal(fakeRow{value: "9090", typ: "int"}))
+		Expect(fake.Row("debug")).To(BeZero())
+		Expect(fake.Row("untyped")).To(BeZero())
+		Expect(fake.Row("name").value).To(Equal("renamed"))
+		Expect(cfg.Pending()).To(BeFalse())
+	})
+
+	It("Should replace a json row by a row per key when one changes", func() {
+		cfg.Set("servers[1]", "c")
+		Expect(cfg.Save()).To(Succeed())
+		Expect(fake.Row("servers")).To(BeZero())
+		Expect(fake.Row("servers[0]")).To(Equal(fakeRow{value: "a", typ: "string"}))
+		Expect(fake.Row("servers[1]")).To(Equal(fakeRow{value: "c", typ: "string"}))
+		Expect(fake.Row("servers.length")).To(Equal(fakeRow{value: "2", typ: "int"}))
+		Expect(fake.Row("database.ports")).To(Equal(fakeRow{value: `{"main":5432}`, typ: "json"}))
+		Expect(cfg.Pending()).To(BeFalse())
+
+		reloaded := NewSQLConfig(db, "settings")
+		Expect(reloaded.Load()).To(Succeed())
+		Expect(reloaded.Get("servers[1]")).To(Equal("c"))
+		Expect(reloaded.Get("servers.length")).To(Equal(2))
+	})
+
+	It("Should replace the row of a key that changed casing", func() {
+		values := cfg.All()
+		delete(values, "name")
+		values["Name"] = "app"
+		cfg.Reset(values)
+		Expect(cfg.Save()).To(Succeed())
+		Expect(fake.Row("name")).To(BeZero())
+		Expect(fake.Row("Name")).To(Equal(fakeRow{value: "app", typ: "string"}))
+	})
+
+	It("Should roll back all the changes when one fails", func() {
+		fake.failKey = "timeout"
+		cfg.Set("port", 9090)
+		cfg.Set("timeout", time.Second)
+		Expect(cfg.Save()).To(MatchError("insert failed"))
+		Expect(fake.commits).To(Equal(0))
+		Expect(fake.Row("port")).To(Equal(fakeRow{value: "8080", typ: "int"}))
+		Expect(fake.Row("timeout")).To(Equal(fakeRow{value: "1m30s", typ: "duration"}))
+		Expect(cfg.Pending()).To(BeTrue())
+
+		fake.failKey = ""
+		Expect(cfg.Save()).To(Succeed())
+		Expect(fake.Row("timeout")).To(Equal(fakeRow{value: "1s", typ: "duration"}))
+	})
+
+	It("Should use the placeholders of the database", func() {
+		cfg.Placeholder = DollarPlaceholder
+		cfg.Set("port", 9090)
+		Expect(cfg.Save()).To(Succeed())
+		Expect(fake.Queries()).To(Equal([]string{
+			"DELETE FROM settings WHERE config_key = $1",
+			"INSERT INTO settings (config_key, config_value, config_type) VALUES ($1, $2, $3)",
+		}))
+	})
+
+	It("Should upsert the changed keys with the statement of the database", func() {
+		cfg.Placeholder = DollarPlaceholder
+		cfg.Upsert = OnConflictUpsert
+		cfg.Set("port", 9090)
+		cfg.Set("debug", nil)
+		Expect(cfg.Save()).To(Succeed())
+		Expect(fake.Queries()).To(Equal([]string{
+			"DELETE FROM settings WHERE config_key = $1",
+			"INSERT INTO settings (config_key, config_value, config_type) VALUES ($1, $2, $3) " +
+				"ON CONFLICT (config_key) DO UPDATE SET config_value = excluded.config_value, config_type = excluded.config_type",
+		}))
+		Expect(fake.Row("port")).To(Equal(fakeRow{value: "9090", typ: "int"}))
+		Expect(fake.Row("debug")).To(BeZero())
+
+		cfg.Placeholder = nil
+		cfg.Upsert = OnDuplicateKeyUpsert
+		cfg.Set("port", 7070)
+		Expect(cfg.Save()).To(Succeed())
+		Expect(fake.Queries()).To(Equal([]string{
+			"INSERT INTO settings (config_key, config_value, config_type) VALUES (?, ?, ?) " +
+				"ON DUPLICATE KEY UPDATE config_value = VALUES(config_value), config_type = VALUES(config_type)",
+		}))
+		Expect(fake.Row("port")).To(Equal(fakeRow{value: "7070", typ: "int"}))
+	})
+
+	Context("With an updated column", func() {
+		BeforeEach(func() {
+			cfg.UpdatedColumn = "updated_at"
+			Expect(cfg.Load()).To(Succeed())
+			fake.Queries()
+		})
+
+		It("Should only read the rows when the table changed", func() {
+			Expect(cfg.Load()).To(Succeed())
+			Expect(fake.Queries()).To(Equal([]string{"SELECT COUNT(*), MAX(updated_at) FROM settings"}))
+
+			fake.Put("port", "9090", "int")
+			Expect(cfg.Load()).To(Succeed())
+			Expect(fake.Queries()).To(HaveLen(2))
+			Expect(cfg.Get("port")).To(Equal(9090))
+		})
+
+		It("Should set the column when saving", func() {
+			before := time.Now().UTC()
+			cfg.Set("port", 9090)
+			Expect(cfg.Save()).To(Succeed())
+			Expect(fake.Row("port").updated).To(BeTemporally(">=", before))
+			Expect(fake.Queries()).To(ContainElement(
+				"INSERT INTO settings (config_key, config_value, config_type, updated_at) VALUES (?, ?, ?, ?)"))
+
+			Expect(cfg.Load()).To(Succeed())
+			Expect(fake.Queries()).To(HaveLen(2))
+			Expect(cfg.Load()).To(Succeed())
+			Expect(fake.Queries()).To(HaveLen(1))
+		})
+
+		It("Should be refreshed by a Refresher", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go NewRefresher(cfg, 10*time.Millisecond).Run(ctx)
+			fake.Put("name", "renamed", "string")
+			Eventually(func() interface{} { return cfg.Get("name") }).Should(Equal("renamed"))
+		})
+	})
+})
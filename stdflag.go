@@ -0,0 +1,48 @@
+package unicon
+
+import (
+	"flag"
+)
+
+// StdFlagSetConfig reads the flags of a standard library flag.FlagSet into
+// the underlaying Configurable.  Only the flags that were set on the
+// command line are imported.
+type StdFlagSetConfig struct {
+	Configurable
+	Prefix     string
+	namespaces []string
+	fs         *flag.FlagSet
+}
+
+// NewStdFlagSetConfig creates a new StdFlagSetConfig and returns it
+func NewStdFlagSetConfig(fs *flag.FlagSet, prefix string, namespaces ...string) *StdFlagSetConfig {
+	cfg := &StdFlagSetConfig{
+		Configurable: NewMemoryConfig(),
+		Prefix:       prefix,
+		namespaces:   nsSlice(namespaces),
+		fs:           fs,
+	}
+	return cfg
+}
+
+// Load loads the flags that were set in the FlagSet to the underlaying
+// Configurable.  Values implementing flag.Getter keep their native type,
+// which is the case for all the values defined by the flag package, other
+// values are imported in their string form.
+// If a Prefix is provided for StdFlagSetConfig then keys are imported with
+// the Prefix removed so -test.asd=1 with Prefix 'test.' imports "asd" with
+// value of 1
+func (sfc *StdFlagSetConfig) Load() (err error) {
+	values := make(map[string]interface{})
+	sfc.fs.Visit(func(f *flag.Flag) {
+		var value interface{}
+		if getter, ok := f.Value.(flag.Getter); ok {
+			value = expandValue(getter.Get())
+		} else {
+			value = f.Value.String()
+		}
+		unmarshal(value, flagKey(f.Name, sfc.Prefix, sfc.namespaces), values)
+	})
+	sfc.Reset(values)
+	return nil
+}
@@ -0,0 +1,71 @@
+package unicon_test
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+// listValue is a custom flag value collecting repeated flags
+type listValue []string
+
+func (l *listValue) String() string     { return strings.Join(*l, ",") }
+func (l *listValue) Set(v string) error { *l = append(*l, v); return nil }
+func (l *listValue) Get() interface{}   { return []string(*l) }
+
+// plainValue is a custom flag value without a Get method
+type plainValue struct{ value string }
+
+func (p *plainValue) String() string     { return p.value }
+func (p *plainValue) Set(v string) error { p.value = v; return nil }
+
+var _ = Describe("StdFlagSetConfig", func() {
+	var fs *flag.FlagSet
+
+	BeforeEach(func() {
+		fs = flag.NewFlagSet("arguments", flag.ContinueOnError)
+		fs.Int("port", 8080, "")
+		fs.Bool("debug", false, "")
+		fs.Duration("timeout", time.Second, "")
+		fs.String("host", "localhost", "")
+	})
+
+	It("Should only import the flags that were set", func() {
+		Expect(fs.Parse([]string{"-port=80", "-debug"})).To(Succeed())
+		cfg := NewStdFlagSetConfig(fs, "")
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.All()).To(Equal(map[string]interface{}{"port": 80, "debug": true}))
+	})
+
+	It("Should preserve the native type of values", func() {
+		Expect(fs.Parse([]string{"-timeout=5s", "-host", "example.com"})).To(Succeed())
+		cfg := NewStdFlagSetConfig(fs, "")
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("timeout")).To(Equal(5 * time.Second))
+		Expect(cfg.Get("host")).To(Equal("example.com"))
+	})
+
+	It("Should read custom values", func() {
+		fs.Var(&listValue{}, "tag", "")
+		fs.Var(&plainValue{}, "mode", "")
+		Expect(fs.Parse([]string{"-tag=a", "-tag=b", "-mode=fast"})).To(Succeed())
+		cfg := NewStdFlagSetConfig(fs, "")
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("tag[0]")).To(Equal("a"))
+		Expect(cfg.Get("tag[1]")).To(Equal("b"))
+		Expect(cfg.Get("tag.length")).To(Equal(2))
+		Expect(cfg.Get("mode")).To(Equal("fast"))
+	})
+
+	It("Should remove the prefix and namespace keys", func() {
+		fs.String("app-postgres-host", "", "")
+		Expect(fs.Parse([]string{"-app-postgres-host=db"})).To(Succeed())
+		cfg := NewStdFlagSetConfig(fs, "app-", "postgres")
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("postgres.host")).To(Equal("db"))
+	})
+})
@@ -3,8 +3,11 @@
 package unicon
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
@@ -48,6 +51,40 @@ type WritableConfig interface {
 	Save() error
 }
 
+// PendingConfig is a WritableConfig that keeps track of the changes that
+// haven't been saved yet
+type PendingConfig interface {
+	WritableConfig
+	// Pending reports whether there are changes that haven't been saved
+	Pending() bool
+}
+
+// DefaultsConfig is a Configurable that also supplies fallback values, such
+// as the defaults of command line flags.  Unicon falls back to them, below
+// its own defaults, when the config is Used or loaded.
+type DefaultsConfig interface {
+	Configurable
+	// Defaults returns the fallback values
+	Defaults() map[string]interface{}
+}
+
+// SourcedConfig is a Configurable that can report where its keys were
+// loaded from
+type SourcedConfig interface {
+	Configurable
+	// Source returns the origin of key, such as a file path, or "" if the
+	// key is not set
+	Source(key string) string
+}
+
+// SensitiveConfig is a Configurable holding secrets, such as passwords,
+// that are redacted when the config is exposed
+type SensitiveConfig interface {
+	Configurable
+	// Sensitive reports whether the value of key is a secret
+	Sensitive(key string) bool
+}
+
 // Config is a Configurable that can Use other Configurables thus build
 // a hierarchy
 type Config interface {
@@ -64,12 +101,29 @@ type Config interface {
 type Unicon struct {
 	// Overrides, these are checked before Configs are iterated for key
 	overrides Configurable
+	// mu guards configs, order and writeLayer, the autosave timer reads
+	// them while Use can change them
+	mu sync.RWMutex
 	// named configurables, these are iterated if key is not found in Config
 	configs map[string]Configurable
+	// names of configs in the order they were first Used
+	order []string
 	// Defaults configurable, if key is not found in the Configurable &
 	// Configurables in Config, defaults is checked for fallback values
 	defaults Configurable
-	prefix   string
+	// defaults supplied by the DefaultsConfig layers, checked after defaults
+	layerDefaults Configurable
+	prefix        string
+	// name of the config in configs that Set writes to, overrides if empty
+	writeLayer string
+	// setMu serializes the writes of Set and BulkSet with updateOverrides,
+	// so that neither loses the changes of the other
+	setMu sync.Mutex
+
+	autosaveMu    sync.Mutex
+	autosaveDelay time.Duration
+	autosaveTimer *time.Timer
+	autosaveError func(error)
 }
 
 // Ensure Unicon implements Config
@@ -89,10 +143,11 @@ func NewConfig(initial Configurable, defaults ...Configurable) *Unicon {
 	}
 
 	return &Unicon{
-		overrides: initial,
-		configs:   make(map[string]Configurable),
-		defaults:  defaults[0],
-		prefix:    "",
+		overrides:     initial,
+		configs:       make(map[string]Configurable),
+		defaults:      defaults[0],
+		layerDefaults: NewMemoryConfig(),
+		prefix:        "",
 	}
 }
 
@@ -115,7 +170,7 @@ func (uni *Unicon) Reset(datas ...map[string]interface{}) {
 	if len(datas) > 0 {
 		data = datas[0]
 	}
-	for _, value := range uni.configs {
+	for _, value := range uni.layers() {
 		if data != nil {
 			value.Reset(data)
 		} else {
@@ -151,17 +206,78 @@ func (uni *Unicon) ResetDefaults(datas ...map[string]interface{}) {
 // conf.Get("key").
 // conf.Use("name") returns a nil value for non existing config named "name".
 func (uni *Unicon) Use(name string, config ...Configurable) Configurable {
+	if len(config) == 0 {
+		return uni.config(name)
+	}
+	uni.mu.Lock()
 	if uni.configs == nil {
 		uni.configs = make(map[string]Configurable)
 	}
-	if len(config) == 0 {
-		return uni.configs[name]
+	if _, ok := uni.configs[name]; !ok {
+		uni.order = append(uni.order, name)
 	}
 	uni.configs[name] = config[0]
-	LoadConfig(uni.configs[name])
+	uni.mu.Unlock()
+	uni.loadLayer(config[0])
+	return config[0]
+}
+
+// config returns the config Used as name, nil if there is none
+func (uni *Unicon) config(name string) Configurable {
+	uni.mu.RLock()
+	defer uni.mu.RUnlock()
 	return uni.configs[name]
 }
 
+// hasLayers reports whether configs were Used, a Sub has none
+func (uni *Unicon) hasLayers() bool {
+	uni.mu.RLock()
+	defer uni.mu.RUnlock()
+	return len(uni.order) > 0
+}
+
+// layers returns the mounted configs in the order they were first Used,
+// which is the order they are searched for keys
+func (uni *Unicon) layers() []Configurable {
+	uni.mu.RLock()
+	defer uni.mu.RUnlock()
+	layers := make([]Configurable, 0, len(uni.order))
+	for _, name := range uni.order {
+		layers = append(layers, uni.configs[name])
+	}
+	return layers
+}
+
+// loadLayer loads a mounted config and updates the defaults it supplies
+func (uni *Unicon) loadLayer(config Configurable) error {
+	err := LoadConfig(config)
+	if _, ok := config.(DefaultsConfig); ok {
+		uni.resetLayerDefaults()
+	}
+	return err
+}
+
+// resetLayerDefaults collects the defaults of the DefaultsConfig layers, the
+// first Used layer wins like it does for values.  They stay below the
+// defaults set with SetDefault.
+func (uni *Unicon) resetLayerDefaults() {
+	values := make(map[string]interface{})
+	layers := uni.layers()
+	for i := len(layers) - 1; i >= 0; i-- {
+		if dc, ok := layers[i].(DefaultsConfig); ok {
+			for key, value := range dc.Defaults() {
+				for name := range values {
+					if strings.EqualFold(name, key) {
+						delete(values, name)
+					}
+				}
+				values[key] = value
+			}
+		}
+	}
+	uni.layerDefaults.Reset(values)
+}
+
 // Get gets the key from first store that it is found from, checks defaults
 func (uni *Unicon) Get(key string) interface{} {
 	key = uni.prefixedKey(key)
@@ -170,7 +286,7 @@ func (uni *Unicon) Get(key string) interface{} {
 		return value
 	}
 	// go through all in insert order until key is found
-	for _, config := range uni.configs {
+	for _, config := range uni.layers() {
 		if value := config.Get(key); value != nil {
 			return value
 		}
@@ -179,10 +295,146 @@ func (uni *Unicon) Get(key string) interface{} {
 	if value := uni.defaults.Get(key); value != nil {
 		return value
 	}
+	if value := uni.layerDefaults.Get(key); value != nil {
+		return value
+	}
 
 	return nil
 }
 
+// resolve returns the Unicon holding the layers that key is read from and
+// the key in it, a Sub reads from the layers of the Unicon it was created
+// from with its prefix added to the key
+func (uni *Unicon) resolve(key string) (*Unicon, string) {
+	if parent, ok := uni.overrides.(*Unicon); ok && !uni.hasLayers() {
+		return parent.resolve(uni.prefixedKey(key))
+	}
+	return uni, uni.prefixedKey(key)
+}
+
+// layer returns the name and the config of the layer that supplies key,
+// "override" or "default" for the overrides and defaults, and the key in
+// that config, which has the prefix of a Sub
+func (uni *Unicon) layer(key string) (string, Configurable, string) {
+	root, key := uni.resolve(key)
+	for _, l := range root.namedLayers() {
+		if l.config.Get(key) != nil {
+			return l.name, l.config, key
+		}
+	}
+	return "", nil, key
+}
+
+// namedLayer is a config of the hierarchy with its name
+type namedLayer struct {
+	name   string
+	config Configurable
+}
+
+// namedLayers returns the overrides, the Used configs and the defaults in
+// the order they are searched for keys
+func (uni *Unicon) namedLayers() []namedLayer {
+	layers := []namedLayer{{"override", uni.overrides}}
+	uni.mu.RLock()
+	for _, name := range uni.order {
+		layers = append(layers, namedLayer{name, uni.configs[name]})
+	}
+	uni.mu.RUnlock()
+	return append(layers, namedLayer{"default", uni.defaults}, namedLayer{"default", uni.layerDefaults})
+}
+
+// LayerValue is the value of a key in one layer of the hierarchy
+type LayerValue struct {
+	// Layer is "override", the name of a Used config or "default"
+	Layer string `json:"layer"`
+	// Origin is the origin of the value reported by a SourcedConfig
+	Origin string      `json:"origin,omitempty"`
+	Value  interface{} `json:"value"`
+	// Sensitive is set if the layer is a SensitiveConfig that marks the
+	// key, or a parent of it, as sensitive
+	Sensitive bool `json:"sensitive,omitempty"`
+}
+
+// Explanation describes where the value of a key comes from
+type Explanation struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+	// Layers holds the value of the key in every layer that sets it, in the
+	// order they are searched, the first one supplies Value
+	Layers []LayerValue `json:"layers"`
+}
+
+// Explain returns the value of key along with the value it has in every
+// layer of the hierarchy, to find out why a key has a value
+func (uni *Unicon) Explain(key string) Explanation {
+	exp := Explanation{Key: key, Value: uni.Get(key), Source: uni.Source(key)}
+	root, full := uni.resolve(key)
+	for _, l := range root.namedLayers() {
+		value := l.config.Get(full)
+		if value == nil {
+			continue
+		}
+		lv := LayerValue{Layer: l.name, Value: value}
+		if sc, ok := l.config.(SourcedConfig); ok {
+			lv.Origin = sc.Source(full)
+		}
+		if sc, ok := l.config.(SensitiveConfig); ok {
+			_, lv.Sensitive = sensitivePrefix(full, sc.Sensitive)
+		}
+		exp.Layers = append(exp.Layers, lv)
+	}
+	return exp
+}
+
+// Source returns where the value Get returns for key comes from: "override"
+// for the values Set on the Unicon, the name of the config it was Used as,
+// followed by the origin in parentheses for a SourcedConfig, or "default".
+// It returns "" if the key is not set.
+func (uni *Unicon) Source(key string) string {
+	name, config, key := uni.layer(key)
+	if sc, ok := config.(SourcedConfig); ok {
+		if source := sc.Source(key); source != "" {
+			return fmt.Sprintf("%s (%s)", name, source)
+		}
+	}
+	return name
+}
+
+// Sensitive reports whether the layer that supplies key is a
+// SensitiveConfig that marks it as sensitive
+func (uni *Unicon) Sensitive(key string) bool {
+	_, config, key := uni.layer(key)
+	sc, ok := config.(SensitiveConfig)
+	return ok && sc.Sensitive(key)
+}
+
+// subtree returns the values visible through the Unicon with the prefix of
+// a Sub removed from their keys, All returns the values of the whole
+// hierarchy for a Sub
+func (uni *Unicon) subtree() map[string]interface{} {
+	prefix := uni.prefixedKey("")
+	for sub := uni; !sub.hasLayers(); {
+		parent, ok := sub.overrides.(*Unicon)
+		if !ok {
+			break
+		}
+		prefix = parent.prefixedKey(prefix)
+		sub = parent
+	}
+	all := uni.All()
+	if prefix == "" {
+		return all
+	}
+	values := make(map[string]interface{})
+	for key, value := range all {
+		if len(key) > len(prefix) && strings.EqualFold(key[:len(prefix)], prefix) {
+			values[key[len(prefix):]] = value
+		}
+	}
+	return values
+}
+
 // GetDefault returns the default for the key, regardless of whether Set()
 // has been called for that key or not.
 func (uni *Unicon) GetDefault(key string) interface{} {
@@ -190,6 +442,9 @@ func (uni *Unicon) GetDefault(key string) interface{} {
 	if value := uni.defaults.Get(key); value != nil {
 		return value
 	}
+	if value := uni.layerDefaults.Get(key); value != nil {
+		return value
+	}
 
 	return nil
 }
@@ -232,19 +487,106 @@ func (uni *Unicon) GetDuration(key string) time.Duration {
 	return cast.ToDuration(uni.Get(key))
 }
 
-// Set sets a key to a particular value
+// Set sets a key to a particular value in the write layer, see
+// SetWriteLayer
 func (uni *Unicon) Set(key string, value interface{}) {
 	out := make(map[string]interface{})
 	unmarshal(value, key, out)
 	uni.BulkSet(out)
 }
 
-// BulkSet overwrites the overrides with items in the provided map
+// BulkSet overwrites the write layer, the overrides unless SetWriteLayer
+// was called, with items in the provided map
 func (uni *Unicon) BulkSet(items map[string]interface{}) {
+	target := uni.overrides
+	uni.mu.RLock()
+	if uni.writeLayer != "" {
+		target = uni.configs[uni.writeLayer]
+	}
+	uni.mu.RUnlock()
+	prefixed := make(map[string]interface{})
 	for k, v := range items {
-		k = uni.prefixedKey(k)
-		uni.overrides.Set(k, v)
+		prefixed[uni.prefixedKey(k)] = v
 	}
+	uni.setMu.Lock()
+	target.BulkSet(prefixed)
+	uni.setMu.Unlock()
+	uni.scheduleAutosave()
+}
+
+// updateOverrides lets fn change a copy of the overrides and replaces them
+// with it in a single Reset, so readers see all the changes or none
+func (uni *Unicon) updateOverrides(fn func(values map[string]interface{})) {
+	uni.setMu.Lock()
+	defer uni.setMu.Unlock()
+	values := uni.overrides.All()
+	fn(values)
+	uni.overrides.Reset(values)
+}
+
+// SetWriteLayer makes Set and BulkSet write to the config mounted as name,
+// such as a JSONConfig holding user preferences, instead of the overrides.
+// An empty name restores writing to the overrides.
+func (uni *Unicon) SetWriteLayer(name string) error {
+	uni.mu.Lock()
+	defer uni.mu.Unlock()
+	if name != "" && uni.configs[name] == nil {
+		return fmt.Errorf("unicon: no config named %q", name)
+	}
+	uni.writeLayer = name
+	return nil
+}
+
+// SetIn sets a key to a particular value in the config mounted as layer
+func (uni *Unicon) SetIn(layer string, key string, value interface{}) error {
+	config := uni.config(layer)
+	if parent, ok := uni.overrides.(*Unicon); ok && config == nil {
+		// a Sub writes to the layers of the Unicon it was created from
+		return parent.SetIn(layer, uni.prefixedKey(key), value)
+	}
+	if config == nil {
+		return fmt.Errorf("unicon: no config named %q", layer)
+	}
+	out := make(map[string]interface{})
+	unmarshal(value, uni.prefixedKey(key), out)
+	config.BulkSet(out)
+	uni.scheduleAutosave()
+	return nil
+}
+
+// SetAutosave makes the Unicon Save itself delay after the last change made
+// through Set, BulkSet or SetIn, so a burst of changes is written once.  A
+// zero delay disables autosave.  Errors from the background Save are passed
+// to onError if given.
+func (uni *Unicon) SetAutosave(delay time.Duration, onError ...func(error)) {
+	uni.autosaveMu.Lock()
+	defer uni.autosaveMu.Unlock()
+	if uni.autosaveTimer != nil {
+		uni.autosaveTimer.Stop()
+		uni.autosaveTimer = nil
+	}
+	uni.autosaveDelay = delay
+	uni.autosaveError = nil
+	if len(onError) > 0 {
+		uni.autosaveError = onError[0]
+	}
+}
+
+func (uni *Unicon) scheduleAutosave() {
+	uni.autosaveMu.Lock()
+	defer uni.autosaveMu.Unlock()
+	if uni.autosaveDelay <= 0 {
+		return
+	}
+	if uni.autosaveTimer != nil {
+		uni.autosaveTimer.Stop()
+	}
+	onError := uni.autosaveError
+	uni.autosaveTimer = time.AfterFunc(uni.autosaveDelay, func() {
+		if err := uni.Save(); err != nil && onError != nil {
+			onError(err)
+		}
+	})
 }
 
 // SetDefault sets the default value, which will be looked up if no
@@ -265,8 +607,16 @@ func (uni *Unicon) BulkSetDefault(items map[string]interface{}) {
 }
 
 // SaveConfig saves if is of type WritableConfig, otherwise does nothing.
+// A PendingConfig is only saved if it has pending changes.
 func SaveConfig(config Configurable) error {
 	switch t := config.(type) {
+	case PendingConfig:
+		if !t.Pending() {
+			return nil
+		}
+		if err := t.Save(); err != nil {
+			return err
+		}
 	case WritableConfig:
 		if err := t.Save(); err != nil {
 			return err
@@ -276,9 +626,9 @@ func SaveConfig(config Configurable) error {
 }
 
 // Save saves all mounted configurations in the hierarchy that implement the
-// WritableConfig interface
+// WritableConfig interface, skipping PendingConfigs without pending changes
 func (uni *Unicon) Save() error {
-	for _, config := range uni.configs {
+	for _, config := range uni.layers() {
 		if err := SaveConfig(config); err != nil {
 			return err
 		}
@@ -299,13 +649,35 @@ func LoadConfig(config Configurable) error {
 }
 
 // Load calls Configurable.Load() on all Configurable objects in the hierarchy.
+// Errors are ignored, use LoadLayers to get them.
 func (uni *Unicon) Load() error {
+	uni.LoadLayers()
+	return nil
+}
+
+// LoadLayers loads every Configurable in the hierarchy like Load, and
+// returns the first error of a Used config, with the name it was Used as.
+// The other configs are still loaded.  Files that don't exist aren't an
+// error, Save creates them.
+func (uni *Unicon) LoadLayers() error {
 	LoadConfig(uni.overrides)
 	LoadConfig(uni.defaults)
-	for _, config := range uni.configs {
-		LoadConfig(config)
+	uni.mu.RLock()
+	names := append([]string(nil), uni.order...)
+	uni.mu.RUnlock()
+
+	var first error
+	for _, name := range names {
+		config := uni.config(name)
+		if config == nil {
+			continue
+		}
+		err := uni.loadLayer(config)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) && first == nil {
+			first = fmt.Errorf("unicon: loading %s: %w", name, err)
+		}
 	}
-	return nil
+	return first
 }
 
 // All returns a map of data from all Configurables in use
@@ -320,20 +692,28 @@ func (uni *Unicon) Load() error {
 // Config.Use("b".).Get("a") == "2".
 func (uni *Unicon) All() map[string]interface{} {
 	values := make(map[string]interface{})
-	// put defaults in values
-	for key, value := range uni.defaults.All() {
-		values[key] = value
-	}
-	// put config values on top of them
-	for _, config := range uni.configs {
-		for key, value := range config.All() {
+	// keys are case insensitive, the casing of the last value put wins
+	casing := make(map[string]string)
+	put := func(items map[string]interface{}) {
+		for key, value := range items {
+			lower := strings.ToLower(key)
+			if old, ok := casing[lower]; ok && old != key {
+				delete(values, old)
+			}
+			casing[lower] = key
 			values[key] = value
 		}
 	}
-	// put overrides from uni on top of all
-	for key, value := range uni.overrides.All() {
-		values[key] = value
+	// put defaults in values, those set with SetDefault on top
+	put(uni.layerDefaults.All())
+	put(uni.defaults.All())
+	// put config values on top of them, the first Used config on top
+	layers := uni.layers()
+	for i := len(layers) - 1; i >= 0; i-- {
+		put(layers[i].All())
 	}
+	// put overrides from uni on top of all
+	put(uni.overrides.All())
 	return values
 }
 
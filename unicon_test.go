@@ -1,6 +1,11 @@
 package unicon_test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -8,6 +13,23 @@ import (
 	. "github.com/taybin/unicon"
 )
 
+// savingConfig counts the calls to Save
+type savingConfig struct {
+	*MemoryConfig
+	saves int32
+}
+
+func (sc *savingConfig) Load() error { return nil }
+
+func (sc *savingConfig) Save() error {
+	atomic.AddInt32(&sc.saves, 1)
+	return nil
+}
+
+func (sc *savingConfig) Saves() int32 {
+	return atomic.LoadInt32(&sc.saves)
+}
+
 var _ = Describe("Unicon", func() {
 	Describe("Config struct", func() {
 		var cfg *Unicon
@@ -74,6 +96,24 @@ var _ = Describe("Unicon", func() {
 			Expect(cfg.Use("json2").Get("asd")).To(Equal("123"))
 		})
 
+		It("Should return the errors of the configs from LoadLayers", func() {
+			dir, err := ioutil.TempDir("", "unicon-load")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			Expect(ioutil.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{`), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "good.json"), []byte(`{"a":1}`), 0600)).To(Succeed())
+			cfg.Use("missing", NewJSONConfig(filepath.Join(dir, "missing.json")))
+			cfg.Use("bad", NewJSONConfig(filepath.Join(dir, "bad.json")))
+			good := cfg.Use("good", NewJSONConfig(filepath.Join(dir, "good.json")))
+
+			Expect(ioutil.WriteFile(filepath.Join(dir, "good.json"), []byte(`{"a":2}`), 0600)).To(Succeed())
+			err = cfg.LoadLayers()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("unicon: loading bad: "))
+			Expect(good.Get("a")).To(Equal(2.0))
+			Expect(cfg.Load()).To(Succeed())
+		})
+
 		It("Should return all values from all storages", func() {
 			cfg.Use("mem1", NewMemoryConfig())
 			cfg.Use("mem2", NewMemoryConfig())
@@ -87,6 +127,17 @@ var _ = Describe("Unicon", func() {
 			}
 			Expect(i).To(Equal(3))
 		})
+		It("Should search configs in the order they were first Used", func() {
+			for _, name := range []string{"a", "b", "c", "d"} {
+				mem := NewMemoryConfig()
+				mem.Set("KEY", name)
+				cfg.Use(name, mem)
+			}
+			cfg.Use("c").Set("only_c", true)
+			cfg.Use("a", NewMemoryConfig())
+			Expect(cfg.Get("key")).To(Equal("b"))
+			Expect(cfg.All()).To(Equal(map[string]interface{}{"KEY": "b", "only_c": true}))
+		})
 		It("Should override defaults when returning All()", func() {
 			cfg.SetDefault("abc", 123)
 			cfg.Set("abc", 234)
@@ -170,6 +221,146 @@ var _ = Describe("Unicon", func() {
 			Expect(cfg.GetInt("A[0]")).To(Equal(123))
 			Expect(cfg.GetInt("A[1]")).To(Equal(321))
 		})
+		Describe("Write layers", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "unicon-write")
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+
+			It("Should route Set to the write layer", func() {
+				user := NewJSONConfig(filepath.Join(dir, "user.json"))
+				cfg.Use("user", user)
+				Expect(cfg.SetWriteLayer("user")).To(Succeed())
+				cfg.Set("theme", "dark")
+				cfg.Sub("editor").Set("tabs", 4)
+				Expect(user.Get("theme")).To(Equal("dark"))
+				Expect(user.GetInt("editor.tabs")).To(Equal(4))
+				Expect(cfg.Get("theme")).To(Equal("dark"))
+
+				Expect(cfg.SetWriteLayer("")).To(Succeed())
+				cfg.Set("theme", "light")
+				Expect(user.Get("theme")).To(Equal("dark"))
+				Expect(cfg.Get("theme")).To(Equal("light"))
+			})
+
+			It("Should error on unknown layers", func() {
+				Expect(cfg.SetWriteLayer("missing")).ToNot(Succeed())
+				Expect(cfg.SetIn("missing", "a", 1)).ToNot(Succeed())
+			})
+
+			It("Should set values in a named layer", func() {
+				cfg.Use("user", NewMemoryConfig())
+				Expect(cfg.SetIn("user", "a", map[string]interface{}{"b": 1})).To(Succeed())
+				Expect(cfg.Use("user").Get("a.b")).To(Equal(1))
+				Expect(cfg.Sub("a").SetIn("user", "c", 2)).To(Succeed())
+				Expect(cfg.Use("user").Get("a.c")).To(Equal(2))
+			})
+
+			It("Should only save layers with pending changes", func() {
+				Expect(ioutil.WriteFile(filepath.Join(dir, "user.json"), []byte(`{}`), 0600)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "system.json"), []byte(`{ "b" : 2 }`), 0600)).To(Succeed())
+				user := NewJSONConfig(filepath.Join(dir, "user.json"))
+				system := NewJSONConfig(filepath.Join(dir, "system.json"))
+				cfg.Use("user", user)
+				cfg.Use("system", system)
+				Expect(user.Pending()).To(BeFalse())
+				Expect(cfg.SetIn("user", "a", 1)).To(Succeed())
+				Expect(user.Pending()).To(BeTrue())
+				Expect(system.Pending()).To(BeFalse())
+
+				Expect(cfg.Save()).To(Succeed())
+				data, err := ioutil.ReadFile(filepath.Join(dir, "system.json"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(data)).To(Equal(`{ "b" : 2 }`))
+				Expect(user.Pending()).To(BeFalse())
+
+				Expect(user.Load()).To(Succeed())
+				Expect(user.Pending()).To(BeFalse())
+				Expect(user.GetInt("a")).To(Equal(1))
+			})
+
+			It("Should keep pending changes when the layer is loaded again", func() {
+				Expect(ioutil.WriteFile(filepath.Join(dir, "user.json"), []byte(`{"theme":"light","tabs":[1,2,3],"font":"mono"}`), 0600)).To(Succeed())
+				user := NewJSONConfig(filepath.Join(dir, "user.json"))
+				cfg.Use("user", user)
+				Expect(cfg.SetWriteLayer("user")).To(Succeed())
+				cfg.Set("theme", "dark")
+				cfg.Set("tabs", []interface{}{4})
+
+				Expect(ioutil.WriteFile(filepath.Join(dir, "user.json"), []byte(`{"theme":"light","tabs":[1,2,3],"font":"sans"}`), 0600)).To(Succeed())
+				Expect(cfg.Load()).To(Succeed())
+				Expect(cfg.Get("theme")).To(Equal("dark"))
+				Expect(cfg.Get("font")).To(Equal("sans"))
+				Expect(cfg.GetInt("tabs.length")).To(Equal(1))
+				Expect(cfg.Get("tabs[1]")).To(BeNil())
+				Expect(user.Pending()).To(BeTrue())
+
+				Expect(cfg.Save()).To(Succeed())
+				Expect(user.Pending()).To(BeFalse())
+				Expect(cfg.Load()).To(Succeed())
+				Expect(cfg.Get("theme")).To(Equal("dark"))
+				Expect(user.Pending()).To(BeFalse())
+			})
+
+			It("Should create missing files on Save", func() {
+				seed := NewMemoryConfig()
+				seed.Set("b", 2)
+				user := NewJSONConfig(filepath.Join(dir, "user.json"))
+				system := NewJSONConfig(filepath.Join(dir, "system.json"), seed)
+				cfg.Use("user", user)
+				cfg.Use("system", system)
+				Expect(user.Pending()).To(BeTrue())
+				Expect(system.Pending()).To(BeTrue())
+
+				Expect(cfg.Save()).To(Succeed())
+				Expect(filepath.Join(dir, "user.json")).To(BeAnExistingFile())
+				data, err := ioutil.ReadFile(filepath.Join(dir, "system.json"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(data)).To(Equal(`{"b":2}`))
+				Expect(user.Pending()).To(BeFalse())
+				Expect(system.Pending()).To(BeFalse())
+			})
+
+			It("Should autosave while configs are Used", func() {
+				saving := &savingConfig{MemoryConfig: NewMemoryConfig()}
+				cfg.Use("user", saving)
+				Expect(cfg.SetWriteLayer("user")).To(Succeed())
+				cfg.SetAutosave(time.Millisecond)
+				for i := 0; i < 20; i++ {
+					cfg.Set("a", i)
+					for j := 0; j < 20; j++ {
+						cfg.Use(fmt.Sprint("layer", i, "-", j), NewMemoryConfig())
+						time.Sleep(100 * time.Microsecond)
+					}
+				}
+				cfg.SetAutosave(0)
+				Expect(saving.Saves()).ToNot(BeZero())
+			})
+
+			It("Should autosave once after a burst of changes", func() {
+				saving := &savingConfig{MemoryConfig: NewMemoryConfig()}
+				cfg.Use("user", saving)
+				Expect(cfg.SetWriteLayer("user")).To(Succeed())
+				cfg.SetAutosave(50 * time.Millisecond)
+				for i := 0; i < 5; i++ {
+					cfg.Set("a", i)
+				}
+				Expect(saving.Saves()).To(BeZero())
+				Eventually(saving.Saves).Should(Equal(int32(1)))
+				Consistently(saving.Saves, 100*time.Millisecond).Should(Equal(int32(1)))
+
+				cfg.SetAutosave(0)
+				cfg.Set("a", 6)
+				Consistently(saving.Saves, 100*time.Millisecond).Should(Equal(int32(1)))
+			})
+		})
 		It("should support bulk setting of defaults", func() {
 			cfg.SetDefault("foo", "oldvalue")
 			cfg.SetDefault("baz", "fuzz")
@@ -195,5 +386,29 @@ var _ = Describe("Unicon", func() {
 			Expect(cfg.GetInt("A[0]")).To(Equal(123))
 			Expect(cfg.GetInt("A[1]")).To(Equal(321))
 		})
+		It("Should report the source of keys", func() {
+			cfg.SetDefault("a", 1)
+			cfg.SetDefault("b", 1)
+			cfg.SetDefault("c.d", 1)
+			cfg.Use("env", NewEnvConfigFrom(EnvList{"B=2", "C_D=2"}, "", "c"))
+			cfg.Set("a", 3)
+			Expect(cfg.Source("a")).To(Equal("override"))
+			Expect(cfg.Source("b")).To(Equal("env"))
+			Expect(cfg.Source("missing")).To(Equal(""))
+			Expect(cfg.Sub("c").Source("d")).To(Equal("env"))
+			cfg.SetDefault("e", 1)
+			Expect(cfg.Source("e")).To(Equal("default"))
+		})
+		It("Should explain the value of keys", func() {
+			cfg.SetDefault("a", 1)
+			cfg.Use("env", NewEnvConfigFrom(EnvList{"A=2"}, ""))
+			exp := cfg.Explain("a")
+			Expect(exp.Value).To(Equal("2"))
+			Expect(exp.Source).To(Equal("env"))
+			Expect(exp.Layers).To(Equal([]LayerValue{
+				{Layer: "env", Value: "2"},
+				{Layer: "default", Value: 1},
+			}))
+		})
 	})
 })
@@ -0,0 +1,149 @@
+// Package uniconcobra reads the flags of a cobra command tree into a Unicon,
+// it is kept apart so that unicon itself doesn't depend on cobra.
+package uniconcobra
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/taybin/unicon"
+)
+
+// Config reads the flags of the command being executed in a cobra command
+// tree.  The flags of a command are namespaced under its path without the
+// root command, so --port of "app serve" is imported as "serve.port" and
+// the flags of the root command aren't namespaced.  Persistent flags are
+// imported under the command that defines them and under every child that
+// inherits them, "app serve --verbose" sets both "verbose" and
+// "serve.verbose".
+type Config struct {
+	unicon.Configurable
+	// ChangedOnly only imports the flags that were set on the command line,
+	// the values of the other flags are returned by Defaults
+	ChangedOnly bool
+	cmd         *cobra.Command
+	defaults    map[string]interface{}
+}
+
+// Ensure Config implements DefaultsConfig
+var _ unicon.DefaultsConfig = (*Config)(nil)
+
+// NewConfig creates a new Config reading the flags of cmd.  Bind updates
+// the command to the one being executed.
+func NewConfig(cmd *cobra.Command) *Config {
+	cfg := &Config{
+		Configurable: unicon.NewMemoryConfig(),
+		cmd:          cmd,
+	}
+	return cfg
+}
+
+// Bind mounts a Config for the command tree of root in uni as name and
+// hooks the PreRunE of every command in the tree, so that before a command
+// runs the flags it was executed with are read, uni is loaded and validated
+// with the validate functions.  An error loading a config of uni, see
+// Unicon.LoadLayers, or from a validate function aborts the command.
+// Existing PreRunE and PreRun hooks are run afterwards.  Commands added to
+// the tree after Bind aren't hooked.
+func Bind(uni *unicon.Unicon, name string, root *cobra.Command, validate ...func(*unicon.Unicon) error) *Config {
+	cfg := NewConfig(root)
+	uni.Use(name, cfg)
+	hook(root, func(cmd *cobra.Command) error {
+		cfg.cmd = cmd
+		if err := uni.LoadLayers(); err != nil {
+			return err
+		}
+		for _, fn := range validate {
+			if err := fn(uni); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return cfg
+}
+
+// hook runs fn before the PreRunE or PreRun of cmd and its children
+func hook(cmd *cobra.Command, fn func(*cobra.Command) error) {
+	preRunE, preRun := cmd.PreRunE, cmd.PreRun
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := fn(cmd); err != nil {
+			return err
+		}
+		if preRunE != nil {
+			return preRunE(cmd, args)
+		}
+		if preRun != nil {
+			preRun(cmd, args)
+		}
+		return nil
+	}
+	for _, child := range cmd.Commands() {
+		hook(child, fn)
+	}
+}
+
+// namespace returns the path of cmd without the root command as a dotted
+// key
+func namespace(cmd *cobra.Command) string {
+	var names []string
+	for ; cmd.HasParent(); cmd = cmd.Parent() {
+		names = append([]string{cmd.Name()}, names...)
+	}
+	return strings.Join(names, ".")
+}
+
+// key returns the key of the flag name in the namespace ns
+func key(ns, name string) string {
+	if ns == "" {
+		return name
+	}
+	return ns + "." + name
+}
+
+// Load loads the flags of the command to the underlaying Configurable.
+// Values keep their native type, slices are expanded into arrays.
+func (cc *Config) Load() (err error) {
+	if cc.cmd == nil {
+		cc.Reset(make(map[string]interface{}))
+		cc.defaults = make(map[string]interface{})
+		return nil
+	}
+	// the flags are renamed to their keys in a flag set of their own and
+	// read with a FlagSetConfig
+	keyed := pflag.NewFlagSet(cc.cmd.Name(), pflag.ContinueOnError)
+	put := func(name string, f *pflag.Flag) {
+		renamed := *f
+		renamed.Name = name
+		renamed.Shorthand = ""
+		keyed.AddFlag(&renamed)
+	}
+	ns := namespace(cc.cmd)
+	cc.cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+		put(key(ns, f.Name), f)
+	})
+	cc.cmd.InheritedFlags().VisitAll(func(f *pflag.Flag) {
+		for parent := cc.cmd.Parent(); parent != nil; parent = parent.Parent() {
+			if parent.PersistentFlags().Lookup(f.Name) != nil {
+				put(key(namespace(parent), f.Name), f)
+				break
+			}
+		}
+		put(key(ns, f.Name), f)
+	})
+	flags := unicon.NewFlagSetConfig(keyed, "")
+	flags.ChangedOnly = cc.ChangedOnly
+	if err := flags.Load(); err != nil {
+		return err
+	}
+	cc.Reset(flags.All())
+	cc.defaults = flags.Defaults()
+	return nil
+}
+
+// Defaults returns the values of the flags that weren't set on the command
+// line when ChangedOnly is set
+func (cc *Config) Defaults() map[string]interface{} {
+	return cc.defaults
+}
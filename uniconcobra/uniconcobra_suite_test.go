@@ -0,0 +1,13 @@
+package uniconcobra_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestUniconcobra(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Uniconcobra Suite")
+}
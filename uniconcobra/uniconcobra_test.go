@@ -0,0 +1,127 @@
+package uniconcobra_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/cobra"
+	. "github.com/taybin/unicon"
+	"github.com/taybin/unicon/uniconcobra"
+)
+
+var _ = Describe("Config", func() {
+	var (
+		root  *cobra.Command
+		serve *cobra.Command
+		http  *cobra.Command
+		ran   *Unicon
+	)
+
+	BeforeEach(func() {
+		ran = nil
+		run := func(cmd *cobra.Command, args []string) {}
+		root = &cobra.Command{Use: "app", Run: run}
+		root.PersistentFlags().Bool("verbose", false, "")
+		root.Flags().String("name", "app", "")
+		serve = &cobra.Command{Use: "serve", Run: run}
+		serve.Flags().Int("port", 8080, "")
+		serve.PersistentFlags().String("host", "localhost", "")
+		http = &cobra.Command{Use: "http", Run: run}
+		http.Flags().StringSlice("origins", nil, "")
+		serve.AddCommand(http)
+		root.AddCommand(serve)
+		root.SilenceUsage = true
+		root.SilenceErrors = true
+	})
+
+	execute := func(args ...string) error {
+		root.SetArgs(args)
+		return root.Execute()
+	}
+
+	It("Should namespace the flags by command path", func() {
+		uni := NewConfig(nil)
+		uniconcobra.Bind(uni, "flags", root)
+		Expect(execute("serve", "--port=80")).To(Succeed())
+		Expect(uni.Get("serve.port")).To(Equal(80))
+		Expect(uni.Get("serve.host")).To(Equal("localhost"))
+		Expect(uni.Get("verbose")).To(Equal(false))
+		Expect(uni.Get("name")).To(BeNil())
+	})
+
+	It("Should make persistent flags visible to children", func() {
+		uni := NewConfig(nil)
+		uniconcobra.Bind(uni, "flags", root)
+		Expect(execute("serve", "http", "--verbose", "--host=example.com", "--origins=a,b")).To(Succeed())
+		Expect(uni.Get("verbose")).To(Equal(true))
+		Expect(uni.Get("serve.host")).To(Equal("example.com"))
+		Expect(uni.Get("serve.http.origins[1]")).To(Equal("b"))
+		sub := uni.Sub("serve.http")
+		Expect(sub.Get("verbose")).To(Equal(true))
+		Expect(sub.Get("host")).To(Equal("example.com"))
+	})
+
+	It("Should supply unchanged flags as defaults", func() {
+		uni := NewConfig(nil)
+		uni.Use("env", NewEnvConfigFrom(EnvList{"APP_SERVE_PORT=6060"}, "APP_", "serve"))
+		flags := uniconcobra.Bind(uni, "flags", root)
+		flags.ChangedOnly = true
+		Expect(execute("serve")).To(Succeed())
+		Expect(uni.Use("flags").All()).To(BeEmpty())
+		Expect(uni.GetInt("serve.port")).To(Equal(6060))
+		Expect(uni.Get("serve.host")).To(Equal("localhost"))
+	})
+
+	It("Should validate before the command runs", func() {
+		uni := NewConfig(nil)
+		serve.Run = func(cmd *cobra.Command, args []string) { ran = uni }
+		uniconcobra.Bind(uni, "flags", root, func(uni *Unicon) error {
+			if uni.GetInt("serve.port") < 1024 {
+				return errors.New("port is privileged")
+			}
+			return nil
+		})
+		Expect(execute("serve", "--port=80")).To(MatchError("port is privileged"))
+		Expect(ran).To(BeNil())
+		Expect(execute("serve", "--port=8000")).To(Succeed())
+		Expect(ran).ToNot(BeNil())
+	})
+
+	It("Should abort the command when a config fails to load", func() {
+		dir, err := ioutil.TempDir("", "unicon-cobra")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "config.json")
+		Expect(ioutil.WriteFile(file, []byte(`{"serve":`), 0600)).To(Succeed())
+
+		uni := NewConfig(nil)
+		serve.Run = func(cmd *cobra.Command, args []string) { ran = uni }
+		uni.Use("missing", NewJSONConfig(filepath.Join(dir, "missing.json")))
+		uni.Use("file", NewJSONConfig(file))
+		uniconcobra.Bind(uni, "flags", root)
+		err = execute("serve")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("loading file"))
+		Expect(ran).To(BeNil())
+
+		Expect(ioutil.WriteFile(file, []byte(`{"serve":{"port":90}}`), 0600)).To(Succeed())
+		Expect(execute("serve")).To(Succeed())
+		Expect(ran).ToNot(BeNil())
+		Expect(uni.GetInt("serve.port")).To(Equal(90))
+	})
+
+	It("Should keep the existing pre-run hooks", func() {
+		var seen interface{}
+		serve.PreRun = func(cmd *cobra.Command, args []string) {
+			seen = cmd.Flag("port").Value.String()
+		}
+		uni := NewConfig(nil)
+		uniconcobra.Bind(uni, "flags", root)
+		Expect(execute("serve", "--port=81")).To(Succeed())
+		Expect(seen).To(Equal("81"))
+	})
+})
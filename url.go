@@ -1,36 +1,412 @@
 package unicon
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"sync"
+	"time"
 )
 
+const (
+	// DefaultURLTimeout is the timeout of the client used by URLConfig when
+	// no Client is set
+	DefaultURLTimeout = 30 * time.Second
+	// DefaultMaxResponseSize is the response size limit used by URLConfig
+	// when MaxSize is not set
+	DefaultMaxResponseSize = 10 << 20
+	// DefaultRetryBackoff is the delay before the first retry of URLConfig
+	// when RetryBackoff is not set
+	DefaultRetryBackoff = 100 * time.Millisecond
+)
+
+var defaultURLClient = &http.Client{Timeout: DefaultURLTimeout}
+
+// StatusError is returned by URLConfig when the server responds with a
+// status other than 2xx
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unicon: GET %s: %s", e.URL, e.Status)
+}
+
+// temporary reports whether the request may succeed when retried
+func (e *StatusError) temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// sizeError is returned by fetch when the document is larger than the limit,
+// it isn't retried since the document won't shrink on its own
+type sizeError struct {
+	url   string
+	limit int64
+}
+
+func (e *sizeError) Error() string {
+	return fmt.Sprintf("unicon: %s is larger than %d bytes", e.url, e.limit)
+}
+
+// StaleError is returned by URLConfig when the document couldn't be fetched
+// and the config keeps serving the values fetched at FetchedAt, from memory
+// or from the cache file
+type StaleError struct {
+	URL       string
+	FetchedAt time.Time
+	Err       error
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("unicon: using %s fetched %s ago: %v", e.URL, time.Since(e.FetchedAt).Round(time.Second), e.Err)
+}
+
+func (e *StaleError) Unwrap() error {
+	return e.Err
+}
+
+// urlCache is the last known good response of a URLConfig, as stored in
+// the cache file
+type urlCache struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	Body         []byte    `json:"body"`
+}
+
 // URLConfig is the url configurable
 type URLConfig struct {
 	Configurable
 	url string
+	// Codec used to decode the response, if nil the codec is picked by the
+	// Content-Type of the response, falling back to json
+	Codec Codec
+	// Client sends the requests, a client with DefaultURLTimeout if nil
+	Client *http.Client
+	// Header is added to the requests
+	Header http.Header
+	// BearerToken, if set, is sent in the Authorization header
+	BearerToken string
+	// Username and Password, if set, are sent with basic authentication
+	Username string
+	Password string
+	// MaxSize is the size limit in bytes of the response, Load fails if the
+	// response is larger.  Defaults to DefaultMaxResponseSize.
+	MaxSize int64
+	// Retries is the number of times a request is retried after a network
+	// error or a 429 or 5xx status
+	Retries int
+	// RetryBackoff is the delay before the first retry, doubled for every
+	// following retry.  Defaults to DefaultRetryBackoff.
+	RetryBackoff time.Duration
+	// CachePath, if set, is the file every successful response is saved to.
+	// When the document can't be fetched the config falls back to it.
+	// Failing to write it doesn't fail Load, see CacheError.
+	CachePath string
+
+	mu       sync.Mutex
+	last     *urlCache
+	stale    bool
+	cacheErr error
 }
 
-// NewURLConfig returns a new Configurable backed by JSON at url
-func NewURLConfig(url string) ReadableConfig {
-	return &URLConfig{NewMemoryConfig(), url}
+// NewURLConfig returns a new Configurable backed by the document at url
+func NewURLConfig(url string) *URLConfig {
+	return &URLConfig{Configurable: NewMemoryConfig(), url: url}
 }
 
-// Load attempts to read a json file at a remote address
-func (uc *URLConfig) Load() error {
-	resp, err := http.Get(uc.url)
+func (uc *URLConfig) codec(contentType string) Codec {
+	if uc.Codec != nil {
+		return uc.Codec
+	}
+	if codec, ok := codecForContentType(contentType); ok {
+		return codec
+	}
+	return JSONCodec{}
+}
+
+func (uc *URLConfig) client() *http.Client {
+	if uc.Client != nil {
+		return uc.Client
+	}
+	return defaultURLClient
+}
+
+// request builds the request for the document, with wait the server is
+// asked to hold it until the document changes
+func (uc *URLConfig) request(ctx context.Context, wait time.Duration) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uc.url, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	for name, values := range uc.Header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if uc.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+uc.BearerToken)
+	} else if uc.Username != "" || uc.Password != "" {
+		req.SetBasicAuth(uc.Username, uc.Password)
+	}
+	if wait > 0 {
+		req.Header.Set("Prefer", fmt.Sprintf("wait=%d", int((wait+time.Second-1)/time.Second)))
+	}
+	uc.mu.Lock()
+	if last := uc.last; last != nil {
+		if last.ETag != "" {
+			req.Header.Set("If-None-Match", last.ETag)
+		}
+		if last.LastModified != "" {
+			req.Header.Set("If-Modified-Since", last.LastModified)
+		}
+	}
+	uc.mu.Unlock()
+	return req, nil
+}
+
+// fetch sends a single request and returns the response with its body
+// read, a 304 response has no body
+func (uc *URLConfig) fetch(ctx context.Context, wait time.Duration) (*http.Response, []byte, error) {
+	req, err := uc.request(ctx, wait)
+	if err != nil {
+		return nil, nil, err
+	}
+	client := uc.client()
+	if wait > 0 && client.Timeout > 0 {
+		// leave the server the time to hold the request
+		extended := *client
+		extended.Timeout += wait
+		client = &extended
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNotModified {
+		return resp, nil, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// drain the body so the connection can be reused
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+		return nil, nil, &StatusError{URL: uc.url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	limit := uc.MaxSize
+	if limit <= 0 {
+		limit = DefaultMaxResponseSize
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, nil, &sizeError{url: uc.url, limit: limit}
+	}
+	return resp, body, nil
+}
+
+// fetchRetry calls fetch until it succeeds, fails with an error that isn't
+// temporary or runs out of retries
+func (uc *URLConfig) fetchRetry(ctx context.Context, wait time.Duration) (*http.Response, []byte, error) {
+	backoff := uc.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
 	}
-	out, err := unmarshalJSON(body)
+	for attempt := 0; ; attempt++ {
+		resp, body, err := uc.fetch(ctx, wait)
+		if err == nil || attempt >= uc.Retries || ctx.Err() != nil {
+			return resp, body, err
+		}
+		switch e := err.(type) {
+		case *StatusError:
+			if !e.temporary() {
+				return nil, nil, err
+			}
+		case *sizeError:
+			return nil, nil, err
+		}
+		timer := time.NewTimer(backoff << uint(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Load attempts to read a config document at a remote address
+func (uc *URLConfig) Load() error {
+	return uc.LoadContext(context.Background())
+}
+
+// LoadContext reads the config document at the remote address, the request
+// and the retries are abandoned when ctx is done.  Once a document has been
+// loaded the request is conditional, a 304 response keeps the values.
+// If the document can't be fetched or decoded, the values loaded before,
+// or the contents of the cache file if nothing was loaded yet, are kept and
+// a *StaleError is returned.
+func (uc *URLConfig) LoadContext(ctx context.Context) error {
+	return uc.load(ctx, 0)
+}
+
+// LongPoll loads the document like LoadContext but asks the server, with a
+// "Prefer: wait" header, to hold the request for up to wait until the
+// document no longer matches the ETag of the loaded one
+func (uc *URLConfig) LongPoll(ctx context.Context, wait time.Duration) error {
+	return uc.load(ctx, wait)
+}
+
+func (uc *URLConfig) load(ctx context.Context, wait time.Duration) error {
+	resp, body, err := uc.fetchRetry(ctx, wait)
 	if err != nil {
-		return err
+		return uc.fallback(err)
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		uc.mu.Lock()
+		defer uc.mu.Unlock()
+		if uc.last == nil {
+			return &StatusError{URL: uc.url, StatusCode: resp.StatusCode, Status: resp.Status}
+		}
+		uc.last.FetchedAt = time.Now()
+		uc.stale = false
+		return nil
+	}
+	contentType := resp.Header.Get("Content-Type")
+	out, err := decode(uc.codec(contentType), body)
+	if err != nil {
+		return uc.fallback(fmt.Errorf("unicon: decoding %s: %w", uc.url, err))
+	}
+	uc.Reset(out)
+	last := &urlCache{
+		URL:          uc.url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ContentType:  contentType,
+		FetchedAt:    time.Now(),
+		Body:         body,
+	}
+	// the document was loaded, a cache file that can't be written is only
+	// reported by CacheError
+	cacheErr := uc.saveCache(last)
+	uc.mu.Lock()
+	uc.last = last
+	uc.stale = false
+	uc.cacheErr = cacheErr
+	uc.mu.Unlock()
+	return nil
+}
+
+// fallback keeps the last known good values after the fetch failed with err
+func (uc *URLConfig) fallback(err error) error {
+	uc.mu.Lock()
+	last := uc.last
+	uc.mu.Unlock()
+	if last == nil {
+		var cacheErr error
+		if last, cacheErr = uc.loadCache(); cacheErr != nil {
+			return err
+		}
+	}
+	uc.mu.Lock()
+	uc.last = last
+	uc.stale = true
+	uc.mu.Unlock()
+	return &StaleError{URL: uc.url, FetchedAt: last.FetchedAt, Err: err}
+}
+
+// loadCache loads the values from the cache file
+func (uc *URLConfig) loadCache() (*urlCache, error) {
+	if uc.CachePath == "" {
+		return nil, errors.New("unicon: no cache file")
+	}
+	data, err := os.ReadFile(uc.CachePath)
+	if err != nil {
+		return nil, err
+	}
+	var cached urlCache
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, err
+	}
+	if cached.URL != uc.url {
+		return nil, fmt.Errorf("unicon: %s caches %s", uc.CachePath, cached.URL)
+	}
+	out, err := decode(uc.codec(cached.ContentType), cached.Body)
+	if err != nil {
+		return nil, err
 	}
 	uc.Reset(out)
+	return &cached, nil
+}
+
+func (uc *URLConfig) saveCache(last *urlCache) error {
+	if uc.CachePath == "" {
+		return nil
+	}
+	data, err := json.Marshal(last)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(uc.CachePath, data, 0); err != nil {
+		return fmt.Errorf("unicon: caching %s: %w", uc.url, err)
+	}
 	return nil
 }
+
+// ETag returns the ETag of the loaded document, "" if the server didn't
+// send one
+func (uc *URLConfig) ETag() string {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	if uc.last == nil {
+		return ""
+	}
+	return uc.last.ETag
+}
+
+// polling reports whether LongPoll can wait for a change
+func (uc *URLConfig) polling() bool {
+	return uc.ETag() != ""
+}
+
+// version returns the ETag of the loaded document
+func (uc *URLConfig) version() string {
+	return uc.ETag()
+}
+
+// Stale reports whether the last Load failed and the config holds the
+// values of an earlier response or of the cache file
+func (uc *URLConfig) Stale() bool {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	return uc.stale
+}
+
+// CacheError returns the error writing the cache file after the last
+// document was fetched, nil if it was written or there is no CachePath
+func (uc *URLConfig) CacheError() error {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	return uc.cacheErr
+}
+
+// FetchedAt returns when the server last returned or confirmed the values
+// of the config, the zero time if nothing was loaded
+func (uc *URLConfig) FetchedAt() time.Time {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	if uc.last == nil {
+		return time.Time{}
+	}
+	return uc.last.FetchedAt
+}
@@ -1,7 +1,17 @@
 package unicon_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -27,4 +37,247 @@ var _ = Describe("URLConfig", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(cfg.Get("test")).To(Equal("abc"))
 	})
+
+	It("Should choose the codec from the Content-Type", func() {
+		RegisterCodec("kv", kvCodec{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/vnd.test+kv; charset=utf-8")
+			fmt.Fprint(w, "test=kv\n")
+		}))
+		defer server.Close()
+
+		url := NewURLConfig(server.URL)
+		Expect(url.Load()).To(Succeed())
+		Expect(url.Get("test")).To(Equal("kv"))
+	})
+
+	Describe("Requests", func() {
+		var (
+			server   *httptest.Server
+			requests int32
+			handler  func(w http.ResponseWriter, r *http.Request, n int32)
+		)
+
+		BeforeEach(func() {
+			atomic.StoreInt32(&requests, 0)
+			handler = func(w http.ResponseWriter, r *http.Request, n int32) {
+				fmt.Fprint(w, `{"test":"ok"}`)
+			}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handler(w, r, atomic.AddInt32(&requests, 1))
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("Should send the headers and bearer token", func() {
+			handler = func(w http.ResponseWriter, r *http.Request, n int32) {
+				fmt.Fprintf(w, `{"auth":%q,"tenant":%q}`, r.Header.Get("Authorization"), r.Header.Get("X-Tenant"))
+			}
+			url := NewURLConfig(server.URL)
+			url.Header = http.Header{"X-Tenant": {"acme"}}
+			url.BearerToken = "secret"
+			Expect(url.Load()).To(Succeed())
+			Expect(url.Get("auth")).To(Equal("Bearer secret"))
+			Expect(url.Get("tenant")).To(Equal("acme"))
+		})
+
+		It("Should send basic authentication", func() {
+			handler = func(w http.ResponseWriter, r *http.Request, n int32) {
+				user, pass, _ := r.BasicAuth()
+				fmt.Fprintf(w, `{"user":%q,"pass":%q}`, user, pass)
+			}
+			url := NewURLConfig(server.URL)
+			url.Username = "user"
+			url.Password = "pass"
+			Expect(url.Load()).To(Succeed())
+			Expect(url.Get("user")).To(Equal("user"))
+			Expect(url.Get("pass")).To(Equal("pass"))
+		})
+
+		It("Should return a StatusError for non-2xx responses", func() {
+			handler = func(w http.ResponseWriter, r *http.Request, n int32) {
+				http.Error(w, "<html>not found</html>", http.StatusNotFound)
+			}
+			url := NewURLConfig(server.URL)
+			url.Retries = 3
+			url.Set("keep", "me")
+			err := url.Load()
+			var statusErr *StatusError
+			Expect(errors.As(err, &statusErr)).To(BeTrue())
+			Expect(statusErr.StatusCode).To(Equal(http.StatusNotFound))
+			Expect(atomic.LoadInt32(&requests)).To(Equal(int32(1)))
+			Expect(url.Get("keep")).To(Equal("me"))
+		})
+
+		It("Should retry temporary failures with backoff", func() {
+			handler = func(w http.ResponseWriter, r *http.Request, n int32) {
+				if n < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				fmt.Fprint(w, `{"test":"ok"}`)
+			}
+			url := NewURLConfig(server.URL)
+			url.Retries = 2
+			url.RetryBackoff = 10 * time.Millisecond
+			start := time.Now()
+			Expect(url.Load()).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically(">=", 30*time.Millisecond))
+			Expect(url.Get("test")).To(Equal("ok"))
+			Expect(atomic.LoadInt32(&requests)).To(Equal(int32(3)))
+		})
+
+		It("Should give up after the retries", func() {
+			handler = func(w http.ResponseWriter, r *http.Request, n int32) {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+			url := NewURLConfig(server.URL)
+			url.Retries = 1
+			url.RetryBackoff = time.Millisecond
+			Expect(url.Load()).To(MatchError(ContainSubstring("502")))
+			Expect(atomic.LoadInt32(&requests)).To(Equal(int32(2)))
+		})
+
+		It("Should limit the response size", func() {
+			handler = func(w http.ResponseWriter, r *http.Request, n int32) {
+				fmt.Fprintf(w, `{"test":%q}`, strings.Repeat("x", 100))
+			}
+			url := NewURLConfig(server.URL)
+			url.MaxSize = 50
+			url.Retries = 2
+			Expect(url.Load()).To(MatchError(ContainSubstring("larger than 50 bytes")))
+			Expect(atomic.LoadInt32(&requests)).To(Equal(int32(1)))
+		})
+
+		It("Should use the client and stop with the context", func() {
+			handler = func(w http.ResponseWriter, r *http.Request, n int32) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			}
+			url := NewURLConfig(server.URL)
+			url.Client = &http.Client{Timeout: 20 * time.Millisecond}
+			Expect(url.Load()).ToNot(Succeed())
+
+			url.Client = nil
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			Expect(url.LoadContext(ctx)).To(MatchError(ContainSubstring("deadline exceeded")))
+		})
+
+		It("Should send conditional requests", func() {
+			handler = func(w http.ResponseWriter, r *http.Request, n int32) {
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", `"v1"`)
+				fmt.Fprint(w, `{"test":"ok"}`)
+			}
+			url := NewURLConfig(server.URL)
+			Expect(url.Load()).To(Succeed())
+			fetched := url.FetchedAt()
+			Expect(url.Load()).To(Succeed())
+			Expect(url.Get("test")).To(Equal("ok"))
+			Expect(url.FetchedAt()).To(BeTemporally(">=", fetched))
+			Expect(url.Stale()).To(BeFalse())
+		})
+
+		It("Should keep the values when the server fails", func() {
+			url := NewURLConfig(server.URL)
+			Expect(url.Load()).To(Succeed())
+			handler = func(w http.ResponseWriter, r *http.Request, n int32) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			err := url.Load()
+			var staleErr *StaleError
+			Expect(errors.As(err, &staleErr)).To(BeTrue())
+			Expect(staleErr.FetchedAt).To(Equal(url.FetchedAt()))
+			var statusErr *StatusError
+			Expect(errors.As(err, &statusErr)).To(BeTrue())
+			Expect(url.Stale()).To(BeTrue())
+			Expect(url.Get("test")).To(Equal("ok"))
+		})
+
+		It("Should keep the values when the document can't be decoded", func() {
+			url := NewURLConfig(server.URL)
+			Expect(url.Load()).To(Succeed())
+			handler = func(w http.ResponseWriter, r *http.Request, n int32) {
+				fmt.Fprint(w, `{"test":`)
+			}
+			err := url.Load()
+			var staleErr *StaleError
+			Expect(errors.As(err, &staleErr)).To(BeTrue())
+			Expect(err).To(MatchError(ContainSubstring("decoding")))
+			Expect(url.Stale()).To(BeTrue())
+			Expect(url.Get("test")).To(Equal("ok"))
+		})
+
+		Describe("CachePath", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "unicon-url")
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+
+			It("Should fall back to the cache file when the server is down", func() {
+				cache := filepath.Join(dir, "config.cache")
+				url := NewURLConfig(server.URL)
+				url.CachePath = cache
+				Expect(url.Load()).To(Succeed())
+				Expect(cache).To(BeAnExistingFile())
+				fetched := url.FetchedAt()
+
+				server.Close()
+				restarted := NewURLConfig(server.URL)
+				restarted.CachePath = cache
+				err := restarted.Load()
+				var staleErr *StaleError
+				Expect(errors.As(err, &staleErr)).To(BeTrue())
+				Expect(staleErr.FetchedAt.Equal(fetched)).To(BeTrue())
+				Expect(err.Error()).To(ContainSubstring("ago"))
+				Expect(restarted.Stale()).To(BeTrue())
+				Expect(restarted.Get("test")).To(Equal("ok"))
+			})
+
+			It("Should load when the cache file can't be written", func() {
+				url := NewURLConfig(server.URL)
+				url.CachePath = filepath.Join(dir, "missing", "config.cache")
+				Expect(url.Load()).To(Succeed())
+				Expect(url.Get("test")).To(Equal("ok"))
+				Expect(url.Stale()).To(BeFalse())
+				Expect(url.CacheError()).To(MatchError(ContainSubstring("caching")))
+
+				url.CachePath = filepath.Join(dir, "config.cache")
+				Expect(url.Load()).To(Succeed())
+				Expect(url.CacheError()).ToNot(HaveOccurred())
+			})
+
+			It("Should not use the cache of another url", func() {
+				cache := filepath.Join(dir, "config.cache")
+				url := NewURLConfig(server.URL)
+				url.CachePath = cache
+				Expect(url.Load()).To(Succeed())
+
+				server.Close()
+				other := NewURLConfig(server.URL + "/other")
+				other.CachePath = cache
+				err := other.Load()
+				Expect(err).To(HaveOccurred())
+				var staleErr *StaleError
+				Expect(errors.As(err, &staleErr)).To(BeFalse())
+				Expect(other.All()).To(BeEmpty())
+			})
+		})
+	})
 })
@@ -2,8 +2,10 @@ package unicon
 
 import (
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 var nsSep = regexp.MustCompile("[-_:]")
@@ -20,6 +22,66 @@ func namespaceKey(key string, namespaces []string) string {
 	return key
 }
 
+// isKeyOrChild reports whether name is key, or a key nested below key, in
+// any casing
+func isKeyOrChild(name, key string) bool {
+	name, key = strings.ToLower(name), strings.ToLower(key)
+	return name == key || strings.HasPrefix(name, key+".") || strings.HasPrefix(name, key+"[")
+}
+
+// keyPrefixes returns the parents of key followed by key itself, for
+// a.b[0].c that is a, a.b, a.b[0] and a.b[0].c
+func keyPrefixes(key string) []string {
+	var prefixes []string
+	for i := 1; i < len(key); i++ {
+		if key[i] == '.' || key[i] == '[' {
+			prefixes = append(prefixes, key[:i])
+		}
+	}
+	return append(prefixes, key)
+}
+
+// mergeFlat merges the flattened values of src into dst.  The keys of dst
+// that src replaces are dropped first: the elements of an array src holds,
+// so that a shorter array leaves no stale elements, the children of a key
+// src sets to a single value and the values src turns into parents.  It
+// returns the dropped keys.
+func mergeFlat(dst, src map[string]interface{}) []string {
+	arrays := make(map[string]bool)
+	keys := make(map[string]bool, len(src))
+	parents := make(map[string]bool)
+	for key, value := range src {
+		key = strings.ToLower(key)
+		if _, ok := value.(int); ok && strings.HasSuffix(key, ".length") {
+			arrays[strings.TrimSuffix(key, ".length")] = true
+		}
+		keys[key] = true
+		prefixes := keyPrefixes(key)
+		for _, prefix := range prefixes[:len(prefixes)-1] {
+			parents[prefix] = true
+		}
+	}
+	var dropped []string
+	for name := range dst {
+		lower := strings.ToLower(name)
+		// the key itself is dropped too, src sets it in its own casing
+		stale := keys[lower] || parents[lower]
+		for _, prefix := range keyPrefixes(lower) {
+			if arrays[prefix] || (keys[prefix] && prefix != lower) {
+				stale = true
+			}
+		}
+		if stale {
+			delete(dst, name)
+			dropped = append(dropped, name)
+		}
+	}
+	for key, value := range src {
+		dst[key] = value
+	}
+	return dropped
+}
+
 func nsSlice(namespaces []string) (lowered []string) {
 	for _, ns := range namespaces {
 		// put in lowercase
@@ -55,3 +117,292 @@ func unmarshalArray(segment []interface{}, segmentPath string, output map[string
 	}
 	output[segmentPath+".length"] = len(segment)
 }
+
+// arrayLength is the value of a synthetic ".length" key while nesting
+type arrayLength int
+
+// nestPadding is the number of array elements nest adds beyond one per
+// flattened key, for the holes of sparse arrays
+const nestPadding = 1024
+
+// nest is the inverse of unmarshal, it rebuilds the nested maps and arrays
+// from flattened keys and drops the synthetic ".length" keys.  Keys that
+// can't be nested because they conflict with another key, such as "a" and
+// "a.b" both holding values, are kept as dotted keys in the nearest object
+// so that unmarshal produces the same flattened key again.  So are indexes
+// and lengths that would make the arrays hold more elements than there are
+// keys, plus nestPadding, such as a stray "a[99999999999]".
+func nest(flat map[string]interface{}) map[string]interface{} {
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	// parents sort before their children, "a" < "a.b" < "a[0]"
+	sort.Strings(keys)
+
+	out := make(map[string]interface{})
+	budget := len(flat) + nestPadding
+	for _, key := range keys {
+		value := flat[key]
+		if length, ok := value.(int); ok && strings.HasSuffix(key, ".length") {
+			nestObject(out, strings.TrimSuffix(key, ".length"), arrayLength(length), &budget)
+			continue
+		}
+		nestObject(out, key, value, &budget)
+	}
+	return finishNest(out).(map[string]interface{})
+}
+
+// splitKey splits the first name off a flattened key, the rest starts
+// with "." or "[" or is empty
+func splitKey(key string) (name, rest string) {
+	if i := strings.IndexAny(key, ".["); i >= 0 {
+		return key[:i], key[i:]
+	}
+	return key, ""
+}
+
+// splitIndex parses a leading "[i]" off a flattened key
+func splitIndex(key string) (index int, rest string, ok bool) {
+	end := strings.Index(key, "]")
+	if !strings.HasPrefix(key, "[") || end < 0 {
+		return 0, "", false
+	}
+	index, err := strconv.Atoi(key[1:end])
+	if err != nil || index < 0 {
+		return 0, "", false
+	}
+	rest = key[end+1:]
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		return 0, "", false
+	}
+	return index, rest, true
+}
+
+// nestArray is an array being built by nest
+type nestArray struct {
+	items []interface{}
+}
+
+// grow makes the array hold length elements, taking the new ones from
+// budget, it fails if budget is short
+func (arr *nestArray) grow(length int, budget *int) bool {
+	added := length - len(arr.items)
+	if added <= 0 {
+		return true
+	}
+	if added > *budget {
+		return false
+	}
+	*budget -= added
+	arr.items = append(arr.items, make([]interface{}, added)...)
+	return true
+}
+
+func nestValue(existing interface{}, value interface{}, budget *int) (interface{}, bool) {
+	length, ok := value.(arrayLength)
+	if !ok {
+		if existing != nil {
+			return nil, false
+		}
+		return value, true
+	}
+	switch existing := existing.(type) {
+	case nil:
+		arr := &nestArray{}
+		if !arr.grow(int(length), budget) {
+			return nil, false
+		}
+		return arr, true
+	case *nestArray:
+		return existing, existing.grow(int(length), budget)
+	}
+	return nil, false
+}
+
+func nestObject(obj map[string]interface{}, key string, value interface{}, budget *int) {
+	name, rest := splitKey(key)
+	if name == "" {
+		if _, ok := value.(arrayLength); !ok {
+			obj[key] = value
+		}
+		return
+	}
+	if rest == "" {
+		if nested, ok := nestValue(obj[name], value, budget); ok {
+			obj[name] = nested
+		}
+		return
+	}
+	if rest[0] == '.' {
+		child, ok := obj[name].(map[string]interface{})
+		if obj[name] == nil {
+			child, ok = make(map[string]interface{}), true
+			obj[name] = child
+		}
+		if ok {
+			nestObject(child, rest[1:], value, budget)
+			return
+		}
+	} else if _, _, valid := splitIndex(rest); valid {
+		child, ok := obj[name].(*nestArray)
+		if obj[name] == nil {
+			child, ok = &nestArray{}, true
+		}
+		if ok && nestIndex(child, rest, value, budget) {
+			obj[name] = child
+			return
+		}
+	}
+	// conflicting key, keep it flattened
+	if _, ok := value.(arrayLength); !ok {
+		obj[key] = value
+	}
+}
+
+func nestIndex(arr *nestArray, key string, value interface{}, budget *int) bool {
+	index, rest, _ := splitIndex(key)
+	// checked before adding one to index, which may be the largest int
+	if index-len(arr.items) >= *budget || !arr.grow(index+1, budget) {
+		return false
+	}
+	if rest == "" {
+		nested, ok := nestValue(arr.items[index], value, budget)
+		if ok {
+			arr.items[index] = nested
+		}
+		return ok
+	}
+	if rest[0] == '.' {
+		child, ok := arr.items[index].(map[string]interface{})
+		if arr.items[index] == nil {
+			child, ok = make(map[string]interface{}), true
+			arr.items[index] = child
+		}
+		if ok {
+			nestObject(child, rest[1:], value, budget)
+		}
+		return ok
+	}
+	if _, _, valid := splitIndex(rest); !valid {
+		return false
+	}
+	child, ok := arr.items[index].(*nestArray)
+	if arr.items[index] == nil {
+		child, ok = &nestArray{}, true
+	}
+	if ok && nestIndex(child, rest, value, budget) {
+		arr.items[index] = child
+		return true
+	}
+	return false
+}
+
+// finishNest replaces the arrays built by nest with []interface{}
+func finishNest(segment interface{}) interface{} {
+	switch segment := segment.(type) {
+	case map[string]interface{}:
+		for k, v := range segment {
+			segment[k] = finishNest(v)
+		}
+		return segment
+	case *nestArray:
+		items := make([]interface{}, len(segment.items))
+		for i, v := range segment.items {
+			items[i] = finishNest(v)
+		}
+		return items
+	}
+	return segment
+}
+
+// changes counts the changes made to a WritableConfig so that it can tell
+// whether there are changes that haven't been saved, and remembers the keys
+// changed so that a Load can keep them
+type changes struct {
+	mu    sync.Mutex
+	made  uint64
+	saved uint64
+	// keys holds the lowercased keys set since the last save or Reset
+	keys map[string]bool
+	// synced is set once the config was loaded from or saved to its store
+	synced bool
+}
+
+// touch counts a change to keys
+func (c *changes) touch(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.made++
+	if c.keys == nil {
+		c.keys = make(map[string]bool)
+	}
+	for _, key := range keys {
+		c.keys[strings.ToLower(key)] = true
+	}
+}
+
+// touchAll counts a change that replaced every key, such as a Reset
+func (c *changes) touchAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.made++
+	c.keys = nil
+}
+
+// snapshot returns the change count to pass to clean once the changes
+// made so far are saved
+func (c *changes) snapshot() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.made
+}
+
+// clean marks the changes counted by snapshot as saved, it is called
+// after a successful Save.  The changed keys are kept if more changes were
+// made since the snapshot.
+func (c *changes) clean(snapshot uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.saved = snapshot
+	c.synced = true
+	if c.saved == c.made {
+		c.keys = nil
+	}
+}
+
+// reload resets config to the loaded values, with the keys set since the
+// last save set on top of them again so that they stay pending.  A Reset
+// that wasn't saved is replaced by the loaded values like any other Load.
+func (c *changes) reload(config Configurable, values map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.synced = true
+	if len(c.keys) == 0 {
+		config.Reset(values)
+		c.saved = c.made
+		return
+	}
+
+	merged := make(map[string]interface{}, len(values)+len(c.keys))
+	for key, value := range values {
+		merged[key] = value
+	}
+	pending := make(map[string]interface{}, len(c.keys))
+	for key, value := range config.All() {
+		if c.keys[strings.ToLower(key)] {
+			pending[key] = value
+		}
+	}
+	mergeFlat(merged, pending)
+	config.Reset(merged)
+}
+
+// pending reports whether there are changes that haven't been saved, or
+// whether the config was never loaded or saved, such as a config seeded
+// with values whose file doesn't exist yet
+func (c *changes) pending() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.made != c.saved || !c.synced
+}
@@ -0,0 +1,320 @@
+package unicon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultVaultAddress is the address of the Vault server used by
+// VaultConfig when Address is not set
+const DefaultVaultAddress = "http://127.0.0.1:8200"
+
+// VaultSecret is the metadata of a secret read by VaultConfig
+type VaultSecret struct {
+	Path        string
+	Version     int
+	CreatedTime time.Time
+	LeaseID     string
+	// LeaseDuration is the TTL of the secret, DefaultTTL when Vault sent
+	// none
+	LeaseDuration time.Duration
+	Renewable     bool
+	ReadAt        time.Time
+}
+
+// expires returns when the secret must be read again, the zero time if
+// it doesn't expire
+func (vs VaultSecret) expires() time.Time {
+	if vs.LeaseDuration <= 0 {
+		return time.Time{}
+	}
+	return vs.ReadAt.Add(vs.LeaseDuration)
+}
+
+// vaultResponse is the body of the Vault responses used by VaultConfig
+type vaultResponse struct {
+	LeaseID       string `json:"lease_id"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+	Data          struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			CreatedTime time.Time `json:"created_time"`
+			Version     int       `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+	Auth *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+	} `json:"auth"`
+}
+
+// VaultConfig is a configurable backed by secrets of a Vault KV version 2
+// secrets engine.  The fields of every secret in Paths are imported below
+// Namespace, the secrets later in Paths override the earlier ones.  All
+// the values are sensitive, they are redacted by Handler and AdminHandler.
+//
+// VaultConfig authenticates with Token or, when RoleID is set, logs in
+// with AppRole and logs in again once the token expires.  Run a Refresher
+// to read the secrets again when their TTL expires.
+type VaultConfig struct {
+	Configurable
+	// Address of the Vault server, DefaultVaultAddress if empty
+	Address string
+	// Mount is the path of the KV secrets engine, "secret" if empty
+	Mount string
+	// Paths of the secrets in the secrets engine
+	Paths []string
+	// Namespace is the key the secrets are imported below, with Namespace
+	// "db" the field password is imported as "db.password"
+	Namespace string
+	// VaultNamespace, if set, is the Vault Enterprise namespace
+	VaultNamespace string
+	// Token authenticates the requests
+	Token string
+	// RoleID and SecretID are the AppRole credentials used when Token is
+	// empty
+	RoleID   string
+	SecretID string
+	// AppRoleMount is the path of the AppRole auth method, "approle" if
+	// empty
+	AppRoleMount string
+	// DefaultTTL is the TTL of the secrets Vault sends no lease duration
+	// for, which is the case of KV version 2.  Zero means they don't expire.
+	DefaultTTL time.Duration
+	// Client sends the requests, a client with DefaultURLTimeout if nil
+	Client *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	secrets     []VaultSecret
+	sources     map[string]string
+}
+
+// Ensure VaultConfig implements SensitiveConfig and SourcedConfig
+var (
+	_ SensitiveConfig = (*VaultConfig)(nil)
+	_ SourcedConfig   = (*VaultConfig)(nil)
+)
+
+// NewVaultConfig returns a new ReadableConfig backed by the secrets at
+// paths of the Vault server at address, imported below namespace
+func NewVaultConfig(address, namespace string, paths ...string) *VaultConfig {
+	return &VaultConfig{
+		Configurable: NewMemoryConfig(),
+		Address:      address,
+		Namespace:    namespace,
+		Paths:        paths,
+	}
+}
+
+func (vc *VaultConfig) client() *http.Client {
+	if vc.Client != nil {
+		return vc.Client
+	}
+	return defaultURLClient
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// do sends a request to the Vault API and returns the decoded response
+func (vc *VaultConfig) do(ctx context.Context, method, path, token string, body interface{}) (*vaultResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	url := strings.TrimSuffix(orDefault(vc.Address, DefaultVaultAddress), "/") + "/v1/" + path
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if vc.VaultNamespace != "" {
+		req.Header.Set("X-Vault-Namespace", vc.VaultNamespace)
+	}
+	resp, err := vc.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+		return nil, &StatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, DefaultMaxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > DefaultMaxResponseSize {
+		return nil, fmt.Errorf("unicon: vault response is larger than %d bytes", DefaultMaxResponseSize)
+	}
+	var out vaultResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("unicon: decoding vault response: %v", err)
+	}
+	return &out, nil
+}
+
+// authToken returns the token to authenticate with, logging in with
+// AppRole when there is no Token and the previous login expired
+func (vc *VaultConfig) authToken(ctx context.Context) (string, error) {
+	if vc.Token != "" || vc.RoleID == "" {
+		return vc.Token, nil
+	}
+	vc.mu.Lock()
+	token, expiry := vc.token, vc.tokenExpiry
+	vc.mu.Unlock()
+	if token != "" && (expiry.IsZero() || time.Now().Before(expiry)) {
+		return token, nil
+	}
+	path := "auth/" + orDefault(vc.AppRoleMount, "approle") + "/login"
+	resp, err := vc.do(ctx, http.MethodPost, path, "", map[string]string{
+		"role_id":   vc.RoleID,
+		"secret_id": vc.SecretID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unicon: vault approle login: %w", err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("unicon: vault approle login returned no token")
+	}
+	expiry = time.Time{}
+	if resp.Auth.LeaseDuration > 0 {
+		expiry = time.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second)
+	}
+	vc.mu.Lock()
+	vc.token, vc.tokenExpiry = resp.Auth.ClientToken, expiry
+	vc.mu.Unlock()
+	return resp.Auth.ClientToken, nil
+}
+
+// Load reads the secrets from Vault
+func (vc *VaultConfig) Load() error {
+	return vc.LoadContext(context.Background())
+}
+
+// LoadContext reads the secrets from Vault, the requests are abandoned
+// when ctx is done
+func (vc *VaultConfig) LoadContext(ctx context.Context) error {
+	values := make(map[string]interface{})
+	sources := make(map[string]string)
+	secrets := make([]VaultSecret, 0, len(vc.Paths))
+	mount := strings.Trim(orDefault(vc.Mount, "secret"), "/")
+	for _, path := range vc.Paths {
+		path = strings.Trim(path, "/")
+		resp, err := vc.read(ctx, mount+"/data/"+path)
+		if err != nil {
+			return err
+		}
+		secret := VaultSecret{
+			Path:          mount + "/" + path,
+			Version:       resp.Data.Metadata.Version,
+			CreatedTime:   resp.Data.Metadata.CreatedTime,
+			LeaseID:       resp.LeaseID,
+			LeaseDuration: time.Duration(resp.LeaseDuration) * time.Second,
+			Renewable:     resp.Renewable,
+			ReadAt:        time.Now(),
+		}
+		if secret.LeaseDuration <= 0 {
+			secret.LeaseDuration = vc.DefaultTTL
+		}
+		secrets = append(secrets, secret)
+
+		fields := make(map[string]interface{})
+		if vc.Namespace != "" {
+			unmarshal(resp.Data.Data, vc.Namespace, fields)
+		} else {
+			unmarshalMap(resp.Data.Data, "", fields)
+		}
+		for key, value := range fields {
+			// a later secret overrides the key in any casing
+			for name := range values {
+				if strings.EqualFold(name, key) {
+					delete(values, name)
+				}
+			}
+			values[key] = value
+			sources[strings.ToLower(key)] = secret.Path
+		}
+	}
+	vc.Reset(values)
+
+	vc.mu.Lock()
+	vc.secrets = secrets
+	vc.sources = sources
+	vc.mu.Unlock()
+	return nil
+}
+
+// read reads a secret, logging in again once if an AppRole token was
+// revoked before it expired
+func (vc *VaultConfig) read(ctx context.Context, path string) (*vaultResponse, error) {
+	token, err := vc.authToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := vc.do(ctx, http.MethodGet, path, token, nil)
+	if se, ok := err.(*StatusError); ok && se.StatusCode == http.StatusForbidden && vc.Token == "" && vc.RoleID != "" {
+		vc.mu.Lock()
+		vc.token = ""
+		vc.mu.Unlock()
+		if token, err = vc.authToken(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = vc.do(ctx, http.MethodGet, path, token, nil)
+	}
+	return resp, err
+}
+
+// Secrets returns the metadata of the secrets read by the last Load
+func (vc *VaultConfig) Secrets() []VaultSecret {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	return append([]VaultSecret(nil), vc.secrets...)
+}
+
+// Expires returns when the first of the secrets expires and must be read
+// again, the zero time if none expires
+func (vc *VaultConfig) Expires() time.Time {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	var first time.Time
+	for _, secret := range vc.secrets {
+		if expires := secret.expires(); !expires.IsZero() && (first.IsZero() || expires.Before(first)) {
+			first = expires
+		}
+	}
+	return first
+}
+
+// Sensitive reports that every value of the config is a secret
+func (vc *VaultConfig) Sensitive(key string) bool {
+	return true
+}
+
+// Source returns the path of the secret that supplied key
+func (vc *VaultConfig) Source(key string) string {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	return vc.sources[strings.ToLower(key)]
+}
@@ -0,0 +1,185 @@
+package unicon_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/taybin/unicon"
+)
+
+// vaultKV is a stand-in for a Vault server with a KV version 2 secrets
+// engine mounted at secret/ and the AppRole auth method
+type vaultKV struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+	version int
+	tokens  map[string]bool
+	logins  int32
+}
+
+func newVaultKV() *vaultKV {
+	return &vaultKV{
+		secrets: map[string]map[string]interface{}{
+			"app/db":  {"username": "app", "password": "hunter2"},
+			"app/api": {"token": "t0ken", "password": "override"},
+		},
+		version: 3,
+		tokens:  map[string]bool{"root": true},
+	}
+}
+
+func (v *vaultKV) Revoke(token string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.tokens, token)
+}
+
+func (v *vaultKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if r.URL.Path == "/v1/auth/approle/login" && r.Method == http.MethodPost {
+		var creds map[string]string
+		json.NewDecoder(r.Body).Decode(&creds)
+		if creds["role_id"] != "role" || creds["secret_id"] != "secret" {
+			http.Error(w, `{"errors":["invalid role or secret ID"]}`, http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(&v.logins, 1)
+		v.tokens["approle-token"] = true
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": "approle-token", "lease_duration": 3600},
+		})
+		return
+	}
+	if !v.tokens[r.Header.Get("X-Vault-Token")] {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+	secret, ok := v.secrets[strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")]
+	if !ok {
+		http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"lease_id":       "",
+		"lease_duration": 0,
+		"renewable":      false,
+		"data": map[string]interface{}{
+			"data": secret,
+			"metadata": map[string]interface{}{
+				"created_time": "2024-01-02T03:04:05Z",
+				"version":      v.version,
+			},
+		},
+	})
+}
+
+var _ = Describe("VaultConfig", func() {
+	var (
+		vault  *vaultKV
+		server *httptest.Server
+	)
+
+	BeforeEach(func() {
+		vault = newVaultKV()
+		server = httptest.NewServer(vault)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Should read the secrets into the namespace with a token", func() {
+		cfg := NewVaultConfig(server.URL, "secrets", "app/db", "app/api")
+		cfg.Token = "root"
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("secrets.username")).To(Equal("app"))
+		Expect(cfg.Get("secrets.token")).To(Equal("t0ken"))
+		Expect(cfg.Get("secrets.password")).To(Equal("override"))
+		Expect(cfg.Source("secrets.username")).To(Equal("secret/app/db"))
+		Expect(cfg.Source("secrets.password")).To(Equal("secret/app/api"))
+	})
+
+	It("Should track the metadata of the secrets", func() {
+		cfg := NewVaultConfig(server.URL, "", "app/db")
+		cfg.Token = "root"
+		Expect(cfg.Load()).To(Succeed())
+		secrets := cfg.Secrets()
+		Expect(secrets).To(HaveLen(1))
+		Expect(secrets[0].Path).To(Equal("secret/app/db"))
+		Expect(secrets[0].Version).To(Equal(3))
+		Expect(secrets[0].CreatedTime).To(Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+		Expect(cfg.Expires().IsZero()).To(BeTrue())
+	})
+
+	It("Should fail with a bad token", func() {
+		cfg := NewVaultConfig(server.URL, "", "app/db")
+		cfg.Token = "bad"
+		Expect(cfg.Load()).To(MatchError(ContainSubstring("403")))
+	})
+
+	It("Should log in with AppRole", func() {
+		cfg := NewVaultConfig(server.URL, "", "app/db")
+		cfg.RoleID = "role"
+		cfg.SecretID = "secret"
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Get("username")).To(Equal("app"))
+		Expect(cfg.Load()).To(Succeed())
+		Expect(atomic.LoadInt32(&vault.logins)).To(Equal(int32(1)))
+
+		vault.Revoke("approle-token")
+		Expect(cfg.Load()).To(Succeed())
+		Expect(atomic.LoadInt32(&vault.logins)).To(Equal(int32(2)))
+
+		cfg.SecretID = "wrong"
+		vault.Revoke("approle-token")
+		Expect(cfg.Load()).To(MatchError(ContainSubstring("approle login")))
+	})
+
+	It("Should be read again when the TTL expires", func() {
+		cfg := NewVaultConfig(server.URL, "db", "app/db")
+		cfg.Token = "root"
+		cfg.DefaultTTL = 50 * time.Millisecond
+		Expect(cfg.Load()).To(Succeed())
+		Expect(cfg.Expires()).To(BeTemporally("~", time.Now().Add(50*time.Millisecond), 50*time.Millisecond))
+
+		vault.mu.Lock()
+		vault.secrets["app/db"] = map[string]interface{}{"password": "rotated"}
+		vault.version++
+		vault.mu.Unlock()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			NewRefresher(cfg, time.Hour).Run(ctx)
+		}()
+		Eventually(func() interface{} { return cfg.Get("db.password") }).Should(Equal("rotated"))
+		Expect(cfg.Secrets()[0].Version).To(Equal(4))
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("Should redact the secrets", func() {
+		cfg := NewVaultConfig(server.URL, "db", "app/db")
+		cfg.Token = "root"
+		uni := NewConfig(nil)
+		uni.Use("vault", cfg)
+		uni.SetDefault("db.host", "localhost")
+		Expect(uni.Sensitive("db.password")).To(BeTrue())
+		Expect(uni.Sensitive("db.host")).To(BeFalse())
+
+		rec := httptest.NewRecorder()
+		NewHandler(uni).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(rec.Body.String()).To(ContainSubstring(`"password":"[redacted]"`))
+		Expect(rec.Body.String()).To(ContainSubstring(`"host":"localhost"`))
+	})
+})